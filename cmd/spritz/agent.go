@@ -0,0 +1,550 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rwtodd/Go.AppUtil/password"
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var agentTimeout time.Duration // how long the agent keeps a secret
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// the slot the CLI keeps its password in
+const defaultSlot = "default"
+
+// how long the CLI waits on the agent before giving up on it
+const agentDialTimeout = time.Second
+
+// agentRequest is sent to the agent, one per connection.
+type agentRequest struct {
+	Op     string `json:"op"` // ping, get, put, forget, lock, unlock, status, stop
+	Slot   string `json:"slot,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// agentResponse is the agent's answer to a request.
+type agentResponse struct {
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Secret string      `json:"secret,omitempty"`
+	Locked bool        `json:"locked,omitempty"`
+	Slots  []agentSlot `json:"slots,omitempty"`
+}
+
+// agentSlot describes a cached secret, without giving it away.
+type agentSlot struct {
+	Name    string    `json:"name"`
+	Expires time.Time `json:"expires"`
+}
+
+// agentSocket gives the path of the agent's socket: $SPRITZ_AGENT_SOCK,
+// or a file in a directory only this user can read.
+func agentSocket() string {
+	if sock := os.Getenv("SPRITZ_AGENT_SOCK"); len(sock) > 0 {
+		return sock
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); len(dir) > 0 {
+		return filepath.Join(dir, "spritz-agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("spritz-%d", os.Getuid()), "agent.sock")
+}
+
+// checkAgentDir makes sure the directory of the socket is this
+// user's alone, so nobody else can put a socket of their own there.
+func checkAgentDir(sock string) error {
+	dir := filepath.Dir(sock)
+	fi, err := os.Lstat(dir)
+	switch {
+	case err != nil:
+		return err
+	case fi.Mode()&os.ModeSymlink != 0:
+		return fmt.Errorf("agent directory %s is a symlink", dir)
+	case !fi.IsDir():
+		return fmt.Errorf("agent directory %s is not a directory", dir)
+	case runtime.GOOS == "windows":
+		return nil
+	case fileOwner(fi) != os.Getuid():
+		return fmt.Errorf("agent directory %s belongs to another user", dir)
+	case fi.Mode().Perm() != 0700:
+		return fmt.Errorf("agent directory %s is open to other users (chmod 700 it)", dir)
+	}
+	return nil
+}
+
+// checkAgentPeer makes sure the agent at the other end of conn runs as
+// this user, by its credentials where the platform gives them, or else
+// by the owner of the socket.
+func checkAgentPeer(conn net.Conn, sock string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	uid, ok := peerUID(conn)
+	if !ok {
+		fi, err := os.Lstat(sock)
+		if err != nil {
+			return err
+		}
+		uid = fileOwner(fi)
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("the agent on %s belongs to another user", sock)
+	}
+	return nil
+}
+
+// askAgent sends a request to the agent and returns its response.
+func askAgent(req agentRequest) (*agentResponse, error) {
+	sock := agentSocket()
+	if err := checkAgentDir(sock); err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", sock, agentDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = checkAgentPeer(conn, sock); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(5 * agentDialTimeout))
+
+	if err = json.NewEncoder(conn).Encode(&req); err != nil {
+		return nil, err
+	}
+	resp := new(agentResponse)
+	if err = json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// agentGet asks a running agent for the secret in a slot.
+func agentGet(slot string) (string, bool) {
+	resp, err := askAgent(agentRequest{Op: "get", Slot: slot})
+	if err != nil || len(resp.Secret) == 0 {
+		return "", false
+	}
+	return resp.Secret, true
+}
+
+// agentPut gives a secret to a running agent, if there is one.
+func agentPut(slot, secret string) {
+	askAgent(agentRequest{Op: "put", Slot: slot, Secret: secret})
+}
+
+// getPassword reads the key file if one was given, or uses the password
+// cached by the agent, or else prompts for one (asking times times, to
+// confirm it).  A new password, asked for twice, is never taken from the
+// agent, but is handed to it once confirmed; one asked for once is only
+// handed over when agentCheck says it worked.
+func getPassword(prompt string, times int) (string, error) {
+	return getSlotPassword(defaultSlot, prompt, times)
+}
+
+// getSlotPassword is like getPassword, but keeps the password in the
+// given slot of the agent.
+func getSlotPassword(slot, prompt string, times int) (string, error) {
+	if kf := keyFileName(); len(kf) > 0 {
+		return readKeyFile(kf)
+	}
+	if times == 1 {
+		if pw, ok := agentGet(slot); ok {
+			slots.Lock()
+			slots.known[slot] = &slotPassword{pw: pw, cached: true}
+			slots.Unlock()
+			return pw, nil
+		}
+	}
+	pw, err := password.Read(prompt, times)
+	if err != nil || len(pw) == 0 {
+		return pw, err
+	}
+	if times > 1 {
+		agentPut(slot, pw)
+	} else {
+		slots.Lock()
+		slots.known[slot] = &slotPassword{pw: pw, typed: true}
+		slots.Unlock()
+	}
+	return pw, nil
+}
+
+// slotPassword is the password this run is using for a slot, and
+// where it came from.
+type slotPassword struct {
+	pw     string
+	cached bool // it came from the agent
+	typed  bool // the user typed it, and it hasn't opened anything yet
+}
+
+// slots holds the passwords got by getSlotPassword.  Its lock is also
+// held while asking again for a wrong one, so that only one of the
+// goroutines hitting it asks.
+var slots = struct {
+	sync.Mutex
+	known map[string]*slotPassword
+}{known: make(map[string]*slotPassword)}
+
+// wrongPassword tells if err came from a password check.
+func wrongPassword(err error) bool {
+	return errors.Is(err, spritz.ErrBadPassword) || errors.Is(err, spritz.ErrWrongPassword)
+}
+
+// agentCheck tells the agent how the password in slot fared, given the
+// error from reading a header with it.  A password the user typed is
+// handed over once it works, so that a typo is never cached, and the
+// agent's own password is dropped once it doesn't.
+func agentCheck(slot string, err error) {
+	wrong := wrongPassword(err)
+	if err != nil && !wrong {
+		return // the failure says nothing about the password
+	}
+
+	slots.Lock()
+	var typed string
+	var cached bool
+	if sp := slots.known[slot]; sp != nil {
+		cached = sp.cached
+		if sp.typed && !wrong {
+			typed, sp.typed = sp.pw, false
+		}
+	}
+	slots.Unlock()
+	switch {
+	case wrong && cached:
+		askAgent(agentRequest{Op: "forget", Slot: slot})
+	case len(typed) > 0:
+		agentPut(slot, typed)
+	}
+}
+
+// agentRetry makes the agent a transparent cache: when trying the
+// password used from slot failed with err, and it was the agent's, the
+// user is asked for the right one.  It gives the password to try again
+// with, and whether to.  Once one goroutine has asked, the others get
+// the new password without asking again.
+func agentRetry(slot, prompt, used string, err error) (string, bool) {
+	if !wrongPassword(err) {
+		return "", false
+	}
+	slots.Lock()
+	defer slots.Unlock()
+	sp := slots.known[slot]
+	switch {
+	case sp == nil:
+		return "", false
+	case sp.pw != used:
+		return sp.pw, true // someone else already asked
+	case !sp.cached:
+		return "", false
+	}
+
+	fmt.Fprintln(os.Stderr, "The agent's password didn't work.")
+	pw, err := password.Read(prompt, 1)
+	if err != nil || len(pw) == 0 {
+		sp.cached = false
+		return "", false
+	}
+	slots.known[slot] = &slotPassword{pw: pw, typed: true}
+	return pw, true
+}
+
+// withPassword calls try with pw, and tells the agent how it fared.
+// If the agent's password was wrong, it asks for the right one and
+// tries again.  It gives the password which was last tried, along
+// with the error from trying it.
+func withPassword(slot, prompt, pw string, try func(string) error) (string, error) {
+	for {
+		err := try(pw)
+		agentCheck(slot, err)
+		npw, again := agentRetry(slot, prompt, pw, err)
+		if !again {
+			return pw, err
+		}
+		pw = npw
+	}
+}
+
+// currentPassword gives the password this run now uses for slot, or
+// pw if it never came from getSlotPassword.
+func currentPassword(slot, pw string) string {
+	slots.Lock()
+	defer slots.Unlock()
+	if sp := slots.known[slot]; sp != nil {
+		return sp.pw
+	}
+	return pw
+}
+
+// agentEntry is a secret held by the agent.
+type agentEntry struct {
+	secret  string
+	expires time.Time
+	timer   *time.Timer
+}
+
+// agentServer holds the secrets, and answers requests for them.
+type agentServer struct {
+	mu      sync.Mutex
+	entries map[string]*agentEntry
+	locked  bool
+	timeout time.Duration
+	stop    chan struct{}
+}
+
+// forget drops the named slot, or all of them if slot is "".  The
+// caller must hold the lock.
+func (as *agentServer) forget(slot string) {
+	for name, e := range as.entries {
+		if len(slot) == 0 || name == slot {
+			e.timer.Stop()
+			delete(as.entries, name)
+		}
+	}
+}
+
+// handle answers one request.
+func (as *agentServer) handle(req *agentRequest) *agentResponse {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	resp := &agentResponse{OK: true, Locked: as.locked}
+	switch req.Op {
+	case "ping":
+	case "get":
+		if e, ok := as.entries[req.Slot]; ok && !as.locked {
+			resp.Secret = e.secret
+		}
+	case "put":
+		if as.locked {
+			return &agentResponse{Error: "agent is locked", Locked: true}
+		}
+		if len(req.Slot) == 0 {
+			return &agentResponse{Error: "no slot given"}
+		}
+		as.forget(req.Slot)
+		slot := req.Slot
+		e := &agentEntry{secret: req.Secret, expires: time.Now().Add(as.timeout)}
+		e.timer = time.AfterFunc(as.timeout, func() {
+			as.mu.Lock()
+			if as.entries[slot] == e {
+				delete(as.entries, slot)
+			}
+			as.mu.Unlock()
+		})
+		as.entries[slot] = e
+	case "forget":
+		as.forget(req.Slot)
+	case "lock":
+		as.forget("")
+		as.locked = true
+		resp.Locked = true
+	case "unlock":
+		as.locked = false
+		resp.Locked = false
+	case "status":
+		for name, e := range as.entries {
+			resp.Slots = append(resp.Slots, agentSlot{name, e.expires})
+		}
+		sort.Slice(resp.Slots, func(i, j int) bool { return resp.Slots[i].Name < resp.Slots[j].Name })
+	case "stop":
+		as.forget("")
+		select {
+		case <-as.stop:
+		default:
+			close(as.stop)
+		}
+	default:
+		return &agentResponse{Error: fmt.Sprintf("unknown request %q", req.Op)}
+	}
+	return resp
+}
+
+// serveConn reads one request from the connection and answers it,
+// if it comes from this user.
+func (as *agentServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	if uid, ok := peerUID(conn); ok && uid != os.Getuid() {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(5 * agentDialTimeout))
+
+	var req agentRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	json.NewEncoder(conn).Encode(as.handle(&req))
+}
+
+// listenAgent sets up the socket, which only this user can use.
+func listenAgent(sock string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(sock), 0700); err != nil {
+		return nil, err
+	}
+	if err := checkAgentDir(sock); err != nil {
+		return nil, err
+	}
+	if _, err := askAgent(agentRequest{Op: "ping"}); err == nil {
+		return nil, fmt.Errorf("an agent is already listening on %s", sock)
+	}
+	os.Remove(sock) // a stale socket, from an agent that died
+
+	oldmask := umask(0077)
+	ln, err := net.Listen("unix", sock)
+	umask(oldmask)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(sock, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serveAgent runs the agent in the foreground, until it is stopped.
+func serveAgent(timeout time.Duration) error {
+	sock := agentSocket()
+	ln, err := listenAgent(sock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sock)
+
+	as := &agentServer{entries: make(map[string]*agentEntry), timeout: timeout, stop: make(chan struct{})}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+		case <-as.stop:
+		}
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			// closed, when stopped or interrupted... let the last
+			// answers go out, then forget everything
+			wg.Wait()
+			as.mu.Lock()
+			as.forget("")
+			as.mu.Unlock()
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			as.serveConn(conn)
+		}()
+	}
+}
+
+// startAgent runs the agent in the background, and waits until it answers.
+func startAgent(timeout time.Duration) error {
+	if _, err := askAgent(agentRequest{Op: "ping"}); err == nil {
+		return fmt.Errorf("an agent is already listening on %s", agentSocket())
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "agent", "serve", "--timeout", timeout.String())
+	detach(cmd)
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	cmd.Process.Release()
+
+	for tries := 0; tries < 50; tries++ {
+		if _, err = askAgent(agentRequest{Op: "ping"}); err == nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("the agent didn't start: %w", err)
+}
+
+func agentUsage(cmdSet *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "Usage: spritz agent (start|serve|status|forget [SLOT]|lock|unlock|stop)")
+	fmt.Fprintln(os.Stderr, "  start   run the agent in the background")
+	fmt.Fprintln(os.Stderr, "  serve   run the agent in the foreground")
+	fmt.Fprintln(os.Stderr, "  status  list the cached passwords and when they expire")
+	fmt.Fprintln(os.Stderr, "  forget  drop one cached password, or all of them")
+	fmt.Fprintln(os.Stderr, "  lock    drop all cached passwords, and cache no more until unlocked")
+	fmt.Fprintln(os.Stderr, "  unlock  start caching passwords again")
+	fmt.Fprintln(os.Stderr, "  stop    drop all cached passwords and exit")
+	cmdSet.PrintDefaults()
+	os.Exit(exitUsage)
+}
+
+func agentMain() {
+	cmdSet := flag.NewFlagSet("agent", flag.ExitOnError)
+	cmdSet.DurationVar(&agentTimeout, "timeout", 15*time.Minute, "how long to keep each password")
+	cmdSet.DurationVar(&agentTimeout, "t", 15*time.Minute, "shorthand for --timeout")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[0] != "forget") {
+		agentUsage(cmdSet)
+	}
+	if agentTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "The --timeout must be positive.")
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	switch args[0] {
+	case "start":
+		if err = startAgent(agentTimeout); err == nil {
+			fmt.Printf("SPRITZ_AGENT_SOCK=%s; export SPRITZ_AGENT_SOCK\n", agentSocket())
+		}
+	case "serve":
+		err = serveAgent(agentTimeout)
+	case "status":
+		var resp *agentResponse
+		if resp, err = askAgent(agentRequest{Op: "status"}); err == nil {
+			if resp.Locked {
+				fmt.Println("agent is locked")
+			}
+			for _, slot := range resp.Slots {
+				fmt.Printf("%s\texpires in %v\n", slot.Name, time.Until(slot.Expires).Round(time.Second))
+			}
+		}
+	case "forget":
+		req := agentRequest{Op: "forget"}
+		if len(args) == 2 {
+			req.Slot = args[1]
+		}
+		_, err = askAgent(req)
+	case "lock", "unlock", "stop":
+		_, err = askAgent(agentRequest{Op: args[0]})
+	default:
+		agentUsage(cmdSet)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent %s: %v\n", args[0], err)
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// readRecoveryCode reads a recovery code from stdin, a line at a
+// time, until it has a whole code or reaches a blank line.
+func readRecoveryCode() ([]byte, error) {
+	if isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, "Type the recovery code, ending with a blank line:")
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	var code strings.Builder
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			if code.Len() == 0 {
+				continue
+			}
+			break
+		}
+		code.WriteString(line + "\n")
+		if key, err := spritz.ParseRecoveryCode(code.String()); err == nil {
+			return key, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return spritz.ParseRecoveryCode(code.String())
+}
+
+func backupKeyMain() {
+	cmdSet := flag.NewFlagSet("backup-key", flag.ExitOnError)
+	cmdSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: spritz backup-key FILE [flags]")
+		fmt.Fprintln(os.Stderr, "  prints a recovery code for FILE, to keep offline")
+		cmdSet.PrintDefaults()
+	}
+	cmdSet.StringVar(&pw, "password", "", "the password of the file")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&keyFile, "key-file", "", "read the password from this file")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) != 1 {
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+	fname := args[0]
+
+	var err error
+	if len(pw) == 0 {
+		if pw, err = getPassword("Password: ", 1); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	key, err := readFileKey(fname, pw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fname, checkFailure(err))
+		os.Exit(exitFailure)
+	}
+
+	// the notes go to stderr, so the code alone can be redirected
+	fmt.Fprintf(os.Stderr, "Recovery code for %s (key id %s).\n", fname, spritz.KeyID(key))
+	fmt.Fprintln(os.Stderr, "Anyone with it can read the file; keep it somewhere safe.")
+	fmt.Println(spritz.RecoveryCode(key))
+}
+
+func restoreKeyMain() {
+	cmdSet := flag.NewFlagSet("restore-key", flag.ExitOnError)
+	cmdSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: spritz restore-key FILE [flags]")
+		fmt.Fprintln(os.Stderr, "  gives FILE a new password, from its recovery code")
+		fmt.Fprintln(os.Stderr, "  reads the code from stdin, so it never shows up in ps or the history")
+		cmdSet.PrintDefaults()
+	}
+	cmdSet.StringVar(&pw, "password", "", "the new password for the file")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	addStrengthFlags(cmdSet)
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) != 1 {
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+	fname := args[0]
+
+	key, err := readRecoveryCode()
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "The code is for key id %s.\n", spritz.KeyID(key))
+		err = restoreKey(fname, key)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fname, err)
+		os.Exit(exitFailure)
+	}
+	fmt.Fprintf(os.Stderr, "%s: restored, with the new password\n", fname)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// catMain decrypts the named files, one after another, to stdout.
+func catMain() {
+	var errCount uint64
+
+	cmdSet := flag.NewFlagSet("cat", flag.ExitOnError)
+	cmdSet.StringVar(&pw, "password", "", "the password to use for decryption")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.BoolVar(&showHeaders, "headers", false, "print each embedded name before its contents")
+	cmdSet.BoolVar(&showHeaders, "H", false, "shorthand for --headers")
+	cmdSet.Parse(os.Args[2:])
+
+	if len(pw) == 0 {
+		pw = readPassword("Password: ", 1)
+	}
+
+	files := cmdSet.Args()
+	if len(files) == 0 {
+		files = append(files, "-")
+	}
+
+	toStdout = true
+	for _, fname := range files {
+		if err := decrypt(currentPassword(defaultSlot, pw), fname, "", startFile(fname)); err != nil {
+			fmt.Fprintf(os.Stderr, "Processing %s: %v\n", fname, err)
+			errCount++
+		}
+	}
+	if errCount > 0 {
+		os.Exit(1)
+	}
+}
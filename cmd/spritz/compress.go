@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// extensions of files which are already compressed (or encrypted),
+// so that compressing them again would only waste time
+var compressedExts = map[string]bool{
+	".7z": true, ".apk": true, ".asc": true, ".avi": true, ".br": true,
+	".bz2": true, ".dat": true, ".docx": true, ".epub": true, ".flac": true,
+	".gif": true, ".gz": true, ".heic": true, ".jar": true, ".jpeg": true,
+	".jpg": true, ".lz4": true, ".mkv": true, ".mov": true, ".mp3": true,
+	".mp4": true, ".ogg": true, ".opus": true, ".png": true, ".rar": true,
+	".spa": true, ".tgz": true, ".webm": true, ".webp": true, ".xlsx": true,
+	".xz": true, ".zip": true, ".zst": true,
+}
+
+// magic numbers at the start of compressed formats
+var compressedMagic = [][]byte{
+	{0x1f, 0x8b},                             // gzip
+	{'P', 'K', 0x03, 0x04},                   // zip, and the office formats
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},         // xz
+	{'B', 'Z', 'h'},                          // bzip2
+	{0x28, 0xb5, 0x2f, 0xfd},                 // zstd
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c},       // 7-zip
+	{0x04, 0x22, 0x4d, 0x18},                 // lz4
+	{'R', 'a', 'r', '!'},                     // rar
+	{0x89, 'P', 'N', 'G'},                    // png
+	{0xff, 0xd8, 0xff},                       // jpeg
+	{'G', 'I', 'F', '8'},                     // gif
+	{'O', 'g', 'g', 'S'},                     // ogg
+	{'f', 'L', 'a', 'C'},                     // flac
+	{'I', 'D', '3'},                          // mp3
+	{'S', 'P', 'Z'},                          // our own v2 and later headers
+	{0x1a, 0x45, 0xdf, 0xa3},                 // matroska and webm
+	{'-', '-', '-', '-', '-', 'B', 'E', 'G'}, // ASCII armor
+}
+
+// compressible guesses whether compressing an input is worthwhile,
+// from its name and the first bytes waiting in br.
+func compressible(fname string, br *bufio.Reader) bool {
+	if compressedExts[strings.ToLower(filepath.Ext(fname))] {
+		return false
+	}
+
+	peek, _ := br.Peek(12)
+	for _, magic := range compressedMagic {
+		if bytes.HasPrefix(peek, magic) {
+			return false
+		}
+	}
+	// the mp4 family has its box type after a 4-byte size
+	if len(peek) >= 8 && string(peek[4:8]) == "ftyp" {
+		return false
+	}
+	return true
+}
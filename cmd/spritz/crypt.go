@@ -3,34 +3,52 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/rwtodd/Go.AppUtil/password"
 	"github.com/rwtodd/Go.Spritz/spritz"
 )
 
 // Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-var pw string        // the password in effect
-var outdir string    // the output directory
-var decryptMode bool // should we decrypt?  Default is to encrypt.
-var checkMode bool   // should we just check the file/pw combo?
-var intname string   // forced internal name
+var pw string         // the password in effect
+var outdir string     // the output directory
+var decryptMode bool  // should we decrypt?  Default is to encrypt.
+var checkMode bool    // should we just check the file/pw combo?
+var intname string    // forced internal name
+var recursive bool    // descend into directories?
+var toStdout bool     // write outputs to stdout, even for named files?
+var showHeaders bool  // print the embedded names on stdout?
+var trustNames bool   // use embedded names as-is, even with directories?
+var legacyHdr bool    // write the old header, with its 32-bit password check?
+var padSpec string    // how to pad the outputs: none, padme, pow2, or block:N
+var armorMode bool    // write the outputs as ASCII armor?
+var compressMode bool // compress inputs before encrypting them?
 // ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 
-func odir(in string) string {
+// cryptJob is a file for the workers to process, along with the
+// directory its output should go in.
+type cryptJob struct {
+	fname string
+	dir   string // the output directory, or "" to use the input's
+}
+
+func odir(in, dir string) string {
 	// if no odir was specified, don't change the directory
-	if len(outdir) == 0 {
+	if len(dir) == 0 {
 		return in
 	}
 
 	// otherwise, put the output file in the specified directory
 	base := filepath.Base(in)
-	return filepath.Join(outdir, base)
+	return filepath.Join(dir, base)
 }
 
 // chext changes the extension of a file name
@@ -44,39 +62,103 @@ func chext(in, ext string) string {
 	return filepath.Join(dir, base+ext)
 }
 
-func encrypt(pw, fn string) error {
+func encrypt(pw, fn, dir string, rep *fileReport) error {
 	var err error
 
 	var inFile, outFile *os.File
+	var atomic *atomicFile
 	var embeddedName string
-	if fn == "-" {
+	switch {
+	case fn == "-":
 		inFile, outFile = os.Stdin, os.Stdout
 		embeddedName = intname
-	} else {
+	case toStdout:
+		embeddedName = filepath.Base(fn)
+		if len(intname) > 0 {
+			embeddedName = intname
+		}
+
+		if inFile, err = os.Open(fn); err != nil {
+			return err
+		}
+		defer inFile.Close()
+		outFile = os.Stdout
+	default:
 		embeddedName = filepath.Base(fn)
 
-		encn := odir(chext(fn, ".dat"))
+		ext := ".dat"
+		if armorMode {
+			ext = ".asc"
+		}
+		encn, err := claimOutput(odir(chext(fn, ext), dir))
+		if err != nil {
+			return err
+		}
+		if len(encn) == 0 {
+			fmt.Printf("%s: output exists, skipping\n", fn)
+			rep.Status = statusSkipped
+			return nil
+		}
 		fmt.Printf("%s -> %s\n", fn, encn)
+		rep.Output = encn
 
 		if inFile, err = os.Open(fn); err != nil {
 			return err
 		}
 		defer inFile.Close()
 
-		outFile, err = os.OpenFile(encn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-		if err != nil {
+		if atomic, err = createAtomic(encn); err != nil {
 			return err
 		}
-		defer outFile.Close()
+		defer atomic.Abort()
+		outFile = atomic.File
 	}
 
-	writer, err := spritz.WrapWriter(outFile, pw, embeddedName)
+	src := rep.countReads(progress.wrap(fn, inFile))
+	opts := spritz.Options{Pad: padding}
+	if compressMode {
+		br := bufio.NewReader(src)
+		if compressible(fn, br) {
+			opts.Compress = spritz.CompressFlate
+		}
+		src = br
+	}
+
+	rep.EmbeddedName = embeddedName
+	writer, err := wrapOutput(rep.countWrites(outFile), pw, embeddedName, headerVersion(), opts)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(writer, inFile)
-	return err
+	// hash the plaintext on the way through, if we'll verify it
+	plainHash := spritz.NewHash(verifyBits)
+	if verifyMode {
+		src = io.TeeReader(src, plainHash)
+	}
+
+	if _, err = spritz.CopyContext(ctx, writer, src); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	if atomic == nil {
+		return nil
+	}
+	if err = atomic.Commit(); err != nil {
+		return err
+	}
+
+	if verifyMode {
+		if err = verifyOutput(pw, atomic.final, plainHash.Sum(nil)); err != nil {
+			return err
+		}
+	}
+	if removeSource {
+		inFile.Close()
+		return removeInput(fn)
+	}
+	return nil
 }
 
 // initDecryption sets up a decryption, by checking that the password
@@ -84,44 +166,206 @@ func encrypt(pw, fn string) error {
 // It returns the io.Reader to read decrypted bytes, the base
 // *os.File for the caller to close, the filename, and any errors
 // it encountered.
-func initDecryption(pw, fn string) (io.Reader, *os.File, string, error) {
+func initDecryption(pw, fn string, rep *fileReport) (io.Reader, *os.File, string, error) {
+	if fn == "-" {
+		// stdin can't be read again, so there's no asking twice
+		src, err := dearmor(rep.countReads(progress.wrap(fn, os.Stdin)))
+		if err != nil {
+			return nil, os.Stdin, "", err
+		}
+		rdr, decn, err := spritz.WrapReader(src, pw)
+		agentCheck(defaultSlot, err)
+		rep.EmbeddedName = decn
+		return rdr, os.Stdin, decn, err
+	}
+
 	var inFile *os.File
+	var rdr io.Reader
+	var decn string
+	_, err := withPassword(defaultSlot, "Password: ", pw, func(pw string) error {
+		if inFile != nil {
+			inFile.Close() // from a try with the wrong password
+			rep.BytesRead = 0
+		}
+		var err error
+		if inFile, err = os.Open(fn); err != nil {
+			return err
+		}
+		src, err := dearmor(rep.countReads(progress.wrap(fn, inFile)))
+		if err != nil {
+			return err
+		}
+		rdr, decn, err = spritz.WrapReader(src, pw)
+		return err
+	})
+	rep.EmbeddedName = decn
+	return rdr, inFile, decn, err
+}
+
+// headerVersion gives the header version to use for new files.
+func headerVersion() int {
+	if legacyHdr {
+		return spritz.HeaderV1
+	}
+	return spritz.HeaderV2
+}
+
+// the padding selected by --pad
+var padding spritz.Padding
+
+// parsePadding interprets the argument to --pad.
+func parsePadding(spec string) (spritz.Padding, error) {
+	switch spec {
+	case "", "none":
+		return spritz.Padding{Policy: spritz.PadNone}, nil
+	case "padme":
+		return spritz.Padding{Policy: spritz.PadPadme}, nil
+	case "pow2":
+		return spritz.Padding{Policy: spritz.PadPowerOfTwo}, nil
+	}
+	if strings.HasPrefix(spec, "block:") {
+		block, err := strconv.ParseInt(spec[len("block:"):], 10, 64)
+		if err == nil && block > 0 {
+			return spritz.Padding{Policy: spritz.PadBlock, Block: block}, nil
+		}
+	}
+	return spritz.Padding{}, fmt.Errorf("bad --pad %q: want none, padme, pow2, or block:N", spec)
+}
+
+// wrapOutput sets up the encrypting writer for an output.  Padding
+// and compression need a version 3 stream; otherwise we stick with
+// the given header version.  The writer must be closed to finish the
+// stream.
+func wrapOutput(sink io.Writer, pw, name string, version int, opts spritz.Options) (io.WriteCloser, error) {
+	var armor io.WriteCloser
 	var err error
+	if armorMode {
+		if armor, err = spritz.NewArmorWriter(sink, nil); err != nil {
+			return nil, err
+		}
+		sink = armor
+	}
 
-	// setup the input
-	if fn == "-" {
-		inFile = os.Stdin
+	var writer io.WriteCloser
+	if opts != (spritz.Options{}) {
+		writer, err = spritz.WrapWriterOptions(sink, pw, name, opts)
 	} else {
-		if inFile, err = os.Open(fn); err != nil {
-			return nil, nil, "", err
-		}
+		var w io.Writer
+		w, err = spritz.WrapWriterVersion(sink, pw, name, version)
+		writer = nopCloser{w}
+	}
+	if err != nil || armor == nil {
+		return writer, err
 	}
+	return armoredWriter{writer, armor}, nil
+}
 
-	rdr, decn, err := spritz.WrapReader(inFile, pw)
-	return rdr, inFile, decn, err
+// nopCloser gives an io.Writer a Close method that does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// armoredWriter finishes the encrypted stream before the armor around it.
+type armoredWriter struct {
+	io.WriteCloser
+	armor io.Closer
+}
+
+func (aw armoredWriter) Close() error {
+	if err := aw.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return aw.armor.Close()
+}
+
+// dearmor strips the ASCII armor from an input, if it has any.
+func dearmor(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if !spritz.IsArmored(br) {
+		return br, nil
+	}
+	rdr, _, err := spritz.NewArmorReader(br)
+	return rdr, err
+}
+
+// checkFailure explains which check of the header failed.
+func checkFailure(err error) error {
+	switch err {
+	case spritz.ErrBadPassword:
+		return fmt.Errorf("failed the 32-bit password check of a v1 header: %w", err)
+	case spritz.ErrWrongPassword:
+		return fmt.Errorf("failed the 256-bit password verifier of a v2 header: %w", err)
+	case spritz.ErrCorruptHeader:
+		return fmt.Errorf("passed the password verifier, but failed the key check: %w", err)
+	case spritz.ErrTruncatedHeader:
+		return fmt.Errorf("failed the header length check: %w", err)
+	case spritz.ErrUnsupported:
+		return fmt.Errorf("passed the password check, but uses options this version can't read: %w", err)
+	}
+	return err
 }
 
-func check(pw, fn string) error {
+func check(pw, fn, dir string, rep *fileReport) error {
 	var err error
 
-	_, fl, decn, err := initDecryption(pw, fn)
+	_, fl, decn, err := initDecryption(pw, fn, rep)
 	if fl != nil {
 		defer fl.Close()
 	}
 	if err != nil {
-		return err
+		return checkFailure(err)
 	}
 
 	fmt.Printf("%s: good file. Unencrypted name is <%s>\n", fn, decn)
 	return nil
 }
 
-func decrypt(pw, fn string) error {
+// errUnsafeName is reported for an embedded name which could direct
+// the output somewhere else.
+var errUnsafeName = errors.New("unsafe embedded name")
+
+// safeName checks an embedded name from an encrypted file, so that a
+// crafted file can't direct its output somewhere else (e.g.
+// "../../.bashrc").  Names with NUL or control characters are refused,
+// and so are names with directories, unless the user trusts the names;
+// even then, ".." and absolute paths are refused.
+func safeName(name string) (string, error) {
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return "", fmt.Errorf("%w %q: it has control characters", errUnsafeName, name)
+		}
+	}
+	slashed := strings.Replace(name, `\`, "/", -1)
+	if !trustNames {
+		if strings.Contains(slashed, "/") || name == "." || name == ".." {
+			return "", fmt.Errorf("%w %q (--trust-names allows directories)", errUnsafeName, name)
+		}
+		return name, nil
+	}
+	if path.IsAbs(slashed) || filepath.IsAbs(name) || len(filepath.VolumeName(name)) > 0 {
+		return "", fmt.Errorf("%w %q: it is an absolute path", errUnsafeName, name)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w %q: it leaves the output directory", errUnsafeName, name)
+		}
+	}
+	clean := path.Clean(slashed)
+	if clean == "." {
+		return "", fmt.Errorf("%w %q: it names no file", errUnsafeName, name)
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+func decrypt(pw, fn, dir string, rep *fileReport) error {
 
 	var outFile *os.File
+	var atomic *atomicFile
 	var err error
 
-	reader, fl, decn, err := initDecryption(pw, fn)
+	reader, fl, decn, err := initDecryption(pw, fn, rep)
 	if fl != nil {
 		defer fl.Close()
 	}
@@ -129,41 +373,130 @@ func decrypt(pw, fn string) error {
 		return err
 	}
 
-	if fn == "-" {
+	switch {
+	case fn == "-" || toStdout:
+		if showHeaders {
+			fmt.Printf("==> %s <==\n", decn)
+		}
 		outFile = os.Stdout
-	} else {
-		if len(decn) == 0 {
+	default:
+		if len(decn) > 0 {
+			if decn, err = safeName(decn); err != nil {
+				return err
+			}
+		}
+		switch {
+		case len(decn) == 0:
 			if strings.HasSuffix(fn, ".spritz") {
 				decn = fn[:len(fn)-7]
 			} else {
 				decn = fn + ".decrypted"
 			}
-		} else {
-			decn = filepath.Join(filepath.Dir(fn), decn)
+			decn = odir(decn, dir)
+		case trustNames:
+			// keep the directories of the name, under the output
+			// directory if there is one
+			if len(dir) == 0 {
+				dir = filepath.Dir(fn)
+			}
+			decn = filepath.Join(dir, decn)
+			if err = os.MkdirAll(filepath.Dir(decn), 0777); err != nil {
+				return err
+			}
+		default:
+			decn = odir(filepath.Join(filepath.Dir(fn), decn), dir)
 		}
 
-		decn = odir(decn)
+		if decn, err = claimOutput(decn); err != nil {
+			return err
+		}
+		if len(decn) == 0 {
+			fmt.Printf("%s: output exists, skipping\n", fn)
+			rep.Status = statusSkipped
+			return nil
+		}
 		fmt.Printf("%s -> %s\n", fn, decn)
+		rep.Output = decn
 
-		outFile, err = os.OpenFile(decn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-		if err != nil {
+		if atomic, err = createAtomic(decn); err != nil {
 			return err
 		}
-		defer outFile.Close()
+		defer atomic.Abort()
+		outFile = atomic.File
 	}
 
-	_, err = io.Copy(outFile, reader)
-	return err
+	if _, err = spritz.CopyContext(ctx, rep.countWrites(outFile), reader); err != nil {
+		return err
+	}
+	if atomic != nil {
+		return atomic.Commit()
+	}
+	return nil
+}
+
+// walkJobs collects the regular files under root, directing the output
+// of each to the matching spot in a mirrored tree under the output
+// directory.  The mirrored directories are created as we go.  The whole
+// tree is read before any work starts, so new outputs are never picked up
+// as inputs.
+func walkJobs(root string) (work []cryptJob, err error) {
+	absOut, err := filepath.Abs(outdir)
+	if err != nil {
+		return
+	}
+
+	err = filepath.Walk(root, func(fname string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if len(outdir) == 0 || checkMode {
+			// no odir means the outputs go next to the inputs
+			if fi.Mode().IsRegular() {
+				work = append(work, cryptJob{fname, ""})
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, fname)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case fi.IsDir():
+			// don't descend into the output tree if it's under root
+			if abs, _ := filepath.Abs(fname); abs == absOut {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(outdir, rel), 0777)
+		case fi.Mode().IsRegular():
+			work = append(work, cryptJob{fname, filepath.Join(outdir, filepath.Dir(rel))})
+		}
+		return nil
+	})
+	return
 }
 
 // processRoutine is the worker goroutine that processes files and keeps track of an error count
-func processRoutine(proc func(string, string) error, input chan string, errs chan uint64) {
+func processRoutine(proc func(string, string, string, *fileReport) error, input chan cryptJob, errs chan uint64) {
 	var errCount uint64
-	for fname := range input {
-		if err := proc(pw, fname); err != nil {
-			fmt.Fprintf(os.Stderr, "Processing %s: %v\n", fname, err)
+	for job := range input {
+		if ctx.Err() != nil {
+			// interrupted, so don't start anything new
+			report.notStarted(job.fname)
 			errCount++
+			continue
 		}
+
+		rep := startFile(job.fname)
+		err := proc(currentPassword(defaultSlot, pw), job.fname, job.dir, rep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Processing %s: %v\n", job.fname, err)
+			errCount++
+		}
+		progress.finish(job.fname, err)
+		report.done(rep, err)
 	}
 	errs <- errCount
 }
@@ -175,6 +508,7 @@ func cryptMain() {
 	cmdSet.StringVar(&intname, "iname", "", "internal name")
 	cmdSet.StringVar(&pw, "password", "", "the password to use for encryption/decryption")
 	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&keyFile, "key-file", "", "read the password from this file")
 	cmdSet.StringVar(&outdir, "odir", "", "the output directory")
 	cmdSet.StringVar(&outdir, "o", "", "shorthand for --odir")
 	cmdSet.IntVar(&jobs, "jobs", 2, "number of concurrent files to work on")
@@ -183,17 +517,60 @@ func cryptMain() {
 	cmdSet.BoolVar(&decryptMode, "decrypt", false, "decrypt the files")
 	cmdSet.BoolVar(&checkMode, "c", false, "shorthand for --check")
 	cmdSet.BoolVar(&checkMode, "check", false, "check the file/pw combination")
+	cmdSet.BoolVar(&recursive, "r", false, "shorthand for --recursive")
+	cmdSet.BoolVar(&recursive, "recursive", false, "process directories, mirroring them under --odir")
+	cmdSet.BoolVar(&force, "force", false, "overwrite existing output files")
+	cmdSet.BoolVar(&force, "f", false, "shorthand for --force")
+	cmdSet.BoolVar(&noClobber, "no-clobber", false, "skip inputs whose output file exists")
+	cmdSet.BoolVar(&noClobber, "n", false, "shorthand for --no-clobber")
+	cmdSet.BoolVar(&useSuffix, "suffix", false, "add a numeric suffix to outputs that would overwrite a file")
+	cmdSet.BoolVar(&toStdout, "stdout", false, "write all output to stdout")
+	cmdSet.BoolVar(&showHeaders, "headers", false, "with --stdout, print each embedded name before its contents")
+	cmdSet.BoolVar(&legacyHdr, "legacy-header", false, "encrypt with the old header, readable by older versions")
+	cmdSet.StringVar(&padSpec, "pad", "none", "pad outputs to hide their size: none, padme, pow2, or block:N")
+	cmdSet.BoolVar(&armorMode, "armor", false, "write outputs as ASCII armor, to paste into email or tickets")
+	cmdSet.BoolVar(&armorMode, "a", false, "shorthand for --armor")
+	cmdSet.BoolVar(&compressMode, "compress", false, "compress inputs before encrypting, unless already compressed")
+	cmdSet.BoolVar(&compressMode, "z", false, "shorthand for --compress")
+	cmdSet.BoolVar(&trustNames, "trust-names", false, "allow directories (but not ..) in embedded names when decrypting")
+	cmdSet.BoolVar(&verifyMode, "verify", false, "decrypt each output to check it against the input")
+	cmdSet.BoolVar(&removeSource, "remove-source", false, "delete each input after its output verifies (implies --verify)")
+	cmdSet.BoolVar(&wipeSource, "wipe", false, "overwrite inputs with random data before --remove-source deletes them")
+	cmdSet.BoolVar(&showProgress, "progress", false, "show progress on stderr")
+	cmdSet.BoolVar(&showStats, "stats", false, "print a summary when done")
+	cmdSet.StringVar(&reportFile, "report", "", "write a JSON report of the run to this file")
+	addStrengthFlags(cmdSet)
 	cmdSet.Parse(os.Args[2:])
 
-	if len(pw) == 0 {
-		var err error
+	if removeSource {
+		verifyMode = true
+	}
+
+	if err := checkPolicy(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	if padding, err = parsePadding(padSpec); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+	if legacyHdr && (padding.Policy != spritz.PadNone || compressMode) {
+		fmt.Fprintf(os.Stderr, "--pad and --compress need the new header, so can't be used with --legacy-header\n")
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
 
+	if len(pw) == 0 {
 		var times = 2
 		if decryptMode || checkMode {
 			times = 1
 		}
 
-		pw, err = password.Read("Password: ", times)
+		pw, err = getPassword("Password: ", times)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
 			os.Exit(1)
@@ -203,11 +580,18 @@ func cryptMain() {
 	if len(pw) == 0 {
 		fmt.Fprintf(os.Stderr, "Missing password.\n")
 		cmdSet.Usage()
-		os.Exit(2)
+		os.Exit(exitUsage)
+	}
+
+	if !(decryptMode || checkMode) {
+		if err = checkStrength(pw); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(exitUsage)
+		}
 	}
 
 	// select the encryption/decryption function
-	var process func(string, string) error
+	var process func(string, string, string, *fileReport) error
 	switch {
 	case checkMode:
 		process = check
@@ -223,14 +607,56 @@ func cryptMain() {
 		files = append(files, "-")
 	}
 
+	// gather up the work to do, descending into directories if asked
+	var work []cryptJob
+	for _, fname := range files {
+		if !recursive || fname == "-" {
+			work = append(work, cryptJob{fname, outdir})
+			continue
+		}
+
+		walked, err := walkJobs(fname)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			errCount++
+		}
+		work = append(work, walked...)
+	}
+
+	// outputs on stdout must come one at a time
+	if toStdout {
+		jobs = 1
+	}
+
+	cancelOnInterrupt()
+	startProgress()
+	for _, job := range work {
+		if fi, err := os.Stat(job.fname); err == nil && fi.Mode().IsRegular() {
+			progress.addTotal(fi.Size())
+		}
+	}
+
+	// errors so far came from walking the directories, not from any one file
+	walkErrs := errCount
+
 	// create the processing goRoutines and feed them
-	input, errs := make(chan string, jobs), make(chan uint64, jobs)
+	input, errs := make(chan cryptJob, jobs), make(chan uint64, jobs)
 	for idx := 0; idx < jobs; idx++ {
 		go processRoutine(process, input, errs)
 	}
 
-	for _, fname := range files {
-		input <- fname
+	var notStarted uint64
+feed:
+	for idx, job := range work {
+		select {
+		case input <- job:
+		case <-ctx.Done():
+			notStarted = uint64(len(work) - idx)
+			for _, job := range work[idx:] {
+				report.notStarted(job.fname)
+			}
+			break feed
+		}
 	}
 
 	// close the input channel and read all the accumulated errors
@@ -238,7 +664,10 @@ func cryptMain() {
 	for idx := 0; idx < jobs; idx++ {
 		errCount += <-errs
 	}
-	if errCount > 0 {
-		os.Exit(1)
+	progress.close()
+	errCount += notStarted
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted: %d of %d files failed or were not processed\n", errCount-walkErrs, len(work))
 	}
+	report.finish("crypt", walkErrs)
 }
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach makes a command its own session, so that it outlives
+// the terminal that started it.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// umask sets the file mode creation mask, returning the old one.
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
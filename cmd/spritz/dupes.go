@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var dupeLink bool     // replace duplicates with hard links?
+var dupeDryRun bool   // only report the links we would make
+var dupeMinSize int64 // skip files smaller than this
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// dupePrefixSize is how much of each file goes into the cheap
+// first-pass hash.
+const dupePrefixSize = 4096
+
+// dupeBits is the size of the hash used to compare files.
+const dupeBits = 256
+
+type dupeResult struct {
+	fname string
+	sum   string
+	err   error
+}
+
+// dupeRoutine is the worker goroutine that hashes files (or their prefixes)
+// for the duplicate finder.
+func dupeRoutine(limit int64, input chan string, output chan dupeResult) {
+	for fname := range input {
+		sum, _, err := hashFile(fname, dupeBits, limit)
+		output <- dupeResult{fname, string(sum), err}
+	}
+}
+
+// groupByHash splits a set of candidate files into groups with identical
+// hashes, using the worker goroutines.  Only groups with more than one
+// member are returned.
+func groupByHash(files []string, limit int64) (groups [][]string, errCount uint64) {
+	input, output := make(chan string, jobs), make(chan dupeResult, jobs)
+	for idx := 0; idx < jobs; idx++ {
+		go dupeRoutine(limit, input, output)
+	}
+	go func() {
+		for _, fname := range files {
+			input <- fname
+		}
+		close(input)
+	}()
+
+	bySum := make(map[string][]string)
+	for range files {
+		res := <-output
+		if res.err != nil {
+			fmt.Fprintf(os.Stderr, "Hashing %s: %v\n", res.fname, res.err)
+			errCount++
+			continue
+		}
+		bySum[res.sum] = append(bySum[res.sum], res.fname)
+	}
+
+	for _, group := range bySum {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return
+}
+
+// linkDupe replaces dupe with a hard link to orig.  The link is made
+// under a temporary name first, so that dupe is never missing.
+func linkDupe(orig, dupe string) error {
+	ofi, err := os.Stat(orig)
+	if err != nil {
+		return err
+	}
+	dfi, err := os.Stat(dupe)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(ofi, dfi) {
+		return nil // already linked
+	}
+
+	if dupeDryRun {
+		fmt.Printf("would link %s -> %s\n", dupe, orig)
+		return nil
+	}
+
+	tmp := filepath.Join(filepath.Dir(dupe), fmt.Sprintf(".%s.spritz-link", filepath.Base(dupe)))
+	if err = os.Link(orig, tmp); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, dupe); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	fmt.Printf("linked %s -> %s\n", dupe, orig)
+	return nil
+}
+
+func dupesMain() {
+	var errCount uint64
+
+	cmdSet := flag.NewFlagSet("dupes", flag.ExitOnError)
+	cmdSet.BoolVar(&dupeLink, "link", false, "replace duplicates with hard links to the first file")
+	cmdSet.BoolVar(&dupeLink, "l", false, "shorthand for --link")
+	cmdSet.BoolVar(&dupeDryRun, "dry-run", false, "only report the links that would be made")
+	cmdSet.BoolVar(&dupeDryRun, "n", false, "shorthand for --dry-run")
+	cmdSet.Int64Var(&dupeMinSize, "min-size", 1, "ignore files smaller than this many bytes")
+	cmdSet.IntVar(&jobs, "jobs", 8, "number of concurrent hashes to compute")
+	cmdSet.IntVar(&jobs, "j", 8, "shorthand for --jobs")
+	cmdSet.Parse(os.Args[2:])
+
+	args := cmdSet.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "No directories given!")
+		cmdSet.Usage()
+		os.Exit(1)
+	}
+	if jobs < 1 {
+		fmt.Fprintln(os.Stderr, "The --jobs must be at least 1.")
+		os.Exit(exitUsage)
+	}
+
+	// stage 1: group the files by size, counting hard links to a file
+	// already seen only once
+	bySize := make(map[int64][]string)
+	byInode := make(map[uint64][]os.FileInfo)
+	for _, dname := range args {
+		err := filepath.Walk(dname, func(fname string, fi os.FileInfo, err error) error {
+			if err != nil {
+				// note it, and carry on with the rest of the tree
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				errCount++
+				return nil
+			}
+			if !fi.Mode().IsRegular() || fi.Size() < dupeMinSize {
+				return nil
+			}
+
+			if ino := fileInode(fi); ino != 0 {
+				for _, seen := range byInode[ino] {
+					if os.SameFile(seen, fi) {
+						return nil
+					}
+				}
+				byInode[ino] = append(byInode[ino], fi)
+			}
+			bySize[fi.Size()] = append(bySize[fi.Size()], fname)
+			return nil
+		})
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			errCount++
+		}
+	}
+
+	// stage 2: split the same-sized files by a hash of their prefix
+	var candidates [][]string
+	for size, files := range bySize {
+		if len(files) < 2 {
+			continue
+		}
+		if size <= dupePrefixSize {
+			// the prefix hash would be the full hash anyway
+			candidates = append(candidates, files)
+			continue
+		}
+		groups, errs := groupByHash(files, dupePrefixSize)
+		errCount += errs
+		candidates = append(candidates, groups...)
+	}
+
+	// stage 3: split the candidates by a hash of the full file
+	var dupes [][]string
+	for _, files := range candidates {
+		groups, errs := groupByHash(files, -1)
+		errCount += errs
+		dupes = append(dupes, groups...)
+	}
+
+	// report the groups in a stable order, and link them if asked
+	for _, group := range dupes {
+		sort.Strings(group)
+	}
+	sort.Slice(dupes, func(i, j int) bool { return dupes[i][0] < dupes[j][0] })
+
+	for _, group := range dupes {
+		for _, fname := range group {
+			fmt.Println(fname)
+		}
+		fmt.Println()
+
+		if dupeLink || dupeDryRun {
+			for _, fname := range group[1:] {
+				if err := linkDupe(group[0], fname); err != nil {
+					fmt.Fprintf(os.Stderr, "Linking %s: %v\n", fname, err)
+					errCount++
+				}
+			}
+		}
+	}
+
+	if errCount > 0 {
+		os.Exit(1)
+	}
+}
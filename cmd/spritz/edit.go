@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var backupExt string // extension for the backup of the old version
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// errNoChanges is reported when the editor left the file as it was.
+var errNoChanges = errors.New("no changes")
+
+// editorCommand gives the user's editor, and any arguments in the
+// variable (e.g., "code --wait").
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if cmd := strings.Fields(os.Getenv(env)); len(cmd) > 0 {
+			return cmd
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// privateTempDir picks a directory for the plaintext, preferring
+// a memory-backed one so it never reaches the disk.
+func privateTempDir() string {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if fi, err := os.Stat(dir); len(dir) > 0 && err == nil && fi.IsDir() {
+			return dir
+		}
+	}
+	return os.TempDir()
+}
+
+// decryptToTemp decrypts fname into a new 0600 temp file, returning
+// the temp file's name, the embedded name, whether the input was
+// armored, how the stream was written, and the hash of the plaintext.
+func decryptToTemp(pw, fname string) (tmpName, embedded string, armored bool, info spritz.StreamInfo, sum []byte, err error) {
+	var inFile *os.File
+	var reader io.Reader
+	_, err = withPassword(defaultSlot, "Password: ", pw, func(pw string) error {
+		if inFile != nil {
+			inFile.Close() // from a try with the wrong password
+		}
+		var err error
+		if inFile, err = os.Open(fname); err != nil {
+			return err
+		}
+
+		br := bufio.NewReader(inFile)
+		armored = spritz.IsArmored(br)
+		src, err := dearmor(br)
+		if err != nil {
+			return err
+		}
+		reader, embedded, info, err = spritz.WrapReaderInfo(src, pw)
+		return err
+	})
+	if inFile != nil {
+		defer inFile.Close()
+	}
+	if err != nil {
+		err = checkFailure(err)
+		return
+	}
+
+	// keep the extension, so the editor can pick its mode
+	base := "note"
+	if len(embedded) > 0 {
+		base = filepath.Base(embedded)
+	}
+	tmp, err := ioutil.TempFile(privateTempDir(), "spritz-*-"+base)
+	if err != nil {
+		return
+	}
+	defer tmp.Close()
+	tmpName = tmp.Name()
+
+	shash := spritz.NewHash(verifyBits)
+	if _, err = io.Copy(io.MultiWriter(tmp, shash), reader); err != nil {
+		return
+	}
+	sum = shash.Sum(nil)
+	err = tmp.Sync()
+	return
+}
+
+// runEditor runs the editor on the file, and waits for it.
+func runEditor(fname string) error {
+	args := editorCommand()
+	cmd := exec.Command(args[0], append(args[1:], fname)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// backupFile keeps a copy of fname as backup, linking it if possible.
+func backupFile(fname, backup string) error {
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(fname, backup) == nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(backup, data, 0600)
+}
+
+// edit decrypts a file, lets the user change it, and encrypts it again.
+// The new version is written like the old one, except for the options
+// the user gave (padGiven and compressGiven).
+func edit(pw, fname string, padGiven, compressGiven bool) error {
+	// ^C goes to the editor; we hold on to it so that we are sure
+	// to clean up the plaintext
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return err
+	}
+
+	tmpName, embedded, armored, info, before, err := decryptToTemp(pw, fname)
+	pw = currentPassword(defaultSlot, pw) // the agent's may have been wrong
+	if len(tmpName) > 0 {
+		// whatever happens from here, don't leave the plaintext behind
+		defer func() {
+			if werr := wipeFile(tmpName); werr != nil {
+				fmt.Fprintf(os.Stderr, "Wiping %s: %v\n", tmpName, werr)
+			}
+			os.Remove(tmpName)
+		}()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = runEditor(tmpName); err != nil {
+		return fmt.Errorf("editor failed, leaving %s unchanged: %w", fname, err)
+	}
+
+	plain, err := os.Open(tmpName)
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+
+	shash := spritz.NewHash(verifyBits)
+	if _, err = io.Copy(shash, plain); err != nil {
+		return err
+	}
+	after := shash.Sum(nil)
+	if bytes.Equal(before, after) {
+		return errNoChanges
+	}
+	if _, err = plain.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// encrypt the new version next to the old one
+	atomic, err := createAtomic(fname)
+	if err != nil {
+		return err
+	}
+	defer atomic.Abort()
+	if err = atomic.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	// the padding policy isn't recorded, so padded files get padme
+	opts := spritz.Options{Pad: padding, Compress: info.Compress}
+	if !padGiven && info.Padded {
+		opts.Pad = spritz.Padding{Policy: spritz.PadPadme}
+	}
+	if compressGiven {
+		opts.Compress = spritz.CompressNone
+		if compressMode {
+			opts.Compress = spritz.CompressFlate
+		}
+	}
+	armorMode = armored
+	writer, err := wrapOutput(atomic.File, pw, embedded, info.Version, opts)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(writer, plain); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	if len(backupExt) > 0 {
+		if err = backupFile(fname, fname+backupExt); err != nil {
+			return fmt.Errorf("making backup: %w", err)
+		}
+	}
+	if err = atomic.Commit(); err != nil {
+		return err
+	}
+	return verifyOutput(pw, fname, after)
+}
+
+func editMain() {
+	cmdSet := flag.NewFlagSet("edit", flag.ExitOnError)
+	cmdSet.StringVar(&pw, "password", "", "the password of the file")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&backupExt, "backup", ".bak", "extension for the backup of the old version (\"\" for none)")
+	cmdSet.StringVar(&padSpec, "pad", "", "pad the new version: none, padme, pow2, or block:N (default: as the old one, padme if padded)")
+	cmdSet.BoolVar(&compressMode, "compress", false, "compress the new version before encrypting it (default: as the old one)")
+	cmdSet.BoolVar(&compressMode, "z", false, "shorthand for --compress")
+	files := parseInterspersed(cmdSet, os.Args[2:])
+	given := make(map[string]bool)
+	cmdSet.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	if len(files) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: spritz edit [flags] FILE.dat")
+		cmdSet.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	if padding, err = parsePadding(padSpec); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	if len(pw) == 0 {
+		pw = readPassword("Password: ", 1)
+	}
+
+	switch err = edit(pw, files[0], given["pad"], given["compress"] || given["z"]); err {
+	case nil:
+		fmt.Printf("%s: saved\n", files[0])
+	case errNoChanges:
+		fmt.Printf("%s: no changes\n", files[0])
+	default:
+		fmt.Fprintf(os.Stderr, "Editing %s: %v\n", files[0], err)
+		os.Exit(exitFailure)
+	}
+}
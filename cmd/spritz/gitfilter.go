@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// errNoKey is reported when a git filter has no way to get the password.
+var errNoKey = errors.New("no key: give --key-file, set $SPRITZ_KEY_FILE, or start the agent")
+
+// filterPassword gets the password without prompting, since git hands
+// the filters their data on stdin: from the key file, or the agent.
+func filterPassword() (string, error) {
+	if kf := keyFileName(); len(kf) > 0 {
+		return readKeyFile(kf)
+	}
+	if pw, ok := agentGet(defaultSlot); ok {
+		return pw, nil
+	}
+	return "", errNoKey
+}
+
+// gitClean encrypts a file on its way into the repository.  The
+// encryption is keyed on the path, and deterministic, so that git
+// sees an unchanged file as unchanged.  Data which is already
+// encrypted (say, because it was checked out without the key)
+// goes in as-is.
+func gitClean(path string, data []byte, out io.Writer) error {
+	if spritz.HasHeader(data) {
+		_, err := out.Write(data)
+		return err
+	}
+
+	pw, err := filterPassword()
+	if err != nil {
+		return err
+	}
+	return spritz.EncryptDeterministic(out, pw, filepath.ToSlash(path), filepath.Base(path), data)
+}
+
+// gitSmudge decrypts a file on its way out of the repository.  Without
+// a key, the encrypted data is checked out instead, so that people who
+// don't have the key can still use the rest of the repository.
+func gitSmudge(path string, data []byte, out io.Writer) error {
+	if !spritz.HasHeader(data) {
+		_, err := out.Write(data)
+		return err
+	}
+
+	pw, err := filterPassword()
+	if err == errNoKey {
+		fmt.Fprintf(os.Stderr, "spritz: %s: %v; checking out the encrypted file\n", path, err)
+		_, err = out.Write(data)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return decryptBytes(pw, data, out)
+}
+
+// decryptBytes decrypts a whole stream held in memory.
+func decryptBytes(pw string, data []byte, out io.Writer) error {
+	rdr, _, err := spritz.WrapReader(bytes.NewReader(data), pw)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, rdr)
+	return err
+}
+
+func gitFilterMain() {
+	cmdSet := flag.NewFlagSet("git-filter", flag.ExitOnError)
+	cmdSet.StringVar(&keyFile, "key-file", "", "read the password from this file")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) < 1 || len(args) > 2 || (args[0] != "clean" && args[0] != "smudge") {
+		fmt.Fprintln(os.Stderr, "Usage: spritz git-filter (clean|smudge) [--key-file FILE] [PATH]")
+		fmt.Fprintf(os.Stderr, "  git gives the file on stdin, and its path as %%f\n")
+		cmdSet.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+	var path string
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err == nil {
+		out := bufio.NewWriter(os.Stdout)
+		if args[0] == "clean" {
+			err = gitClean(path, data, out)
+		} else {
+			err = gitSmudge(path, data, out)
+		}
+		if ferr := out.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "spritz git-filter %s %s: %v\n", args[0], path, err)
+		os.Exit(exitFailure)
+	}
+}
+
+func gitTextconvMain() {
+	cmdSet := flag.NewFlagSet("git-textconv", flag.ExitOnError)
+	cmdSet.StringVar(&keyFile, "key-file", "", "read the password from this file")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: spritz git-textconv [--key-file FILE] FILE")
+		cmdSet.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err == nil {
+		out := bufio.NewWriter(os.Stdout)
+		err = gitSmudge(args[0], data, out)
+		if ferr := out.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "spritz git-textconv %s: %v\n", args[0], err)
+		os.Exit(exitFailure)
+	}
+}
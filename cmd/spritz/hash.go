@@ -14,51 +14,116 @@ import (
 // Cmdline arguments ~~~~~~~~~~~~~~~~~~~~~~
 var bitSize int
 var asHex bool
+var cacheFile string // where to keep previously-computed hashes
+var rehash bool      // ignore cached hashes?
 
 // ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 
-// hash performs the actual hash, and prints out the result.
-func hash(fname string) (err error) {
-	byteSize := (bitSize + 7) / 8
-	var inFile *os.File
+// hashFile computes the hash of the named file (or stdin for "-"),
+// reading at most limit bytes. A negative limit reads the whole file.
+// It also gives the number of bytes it read.
+func hashFile(fname string, bits int, limit int64) ([]byte, int64, error) {
+	fl := os.Stdin
 
-	if fname == "-" {
-		inFile = os.Stdin
-		fname = ""
+	if fname != "-" {
+		var err error
+		if fl, err = os.Open(fname); err != nil {
+			return nil, 0, err
+		}
+		defer fl.Close()
+	}
+
+	var inFile io.Reader
+	if limit >= 0 {
+		inFile = io.LimitReader(fl, limit)
 	} else {
-		if inFile, err = os.Open(fname); err != nil {
-			return
+		inFile = progress.wrap(fname, fl)
+	}
+
+	shash := spritz.NewHash(bits)
+	n, err := spritz.CopyContext(ctx, shash, inFile)
+	if err != nil {
+		return nil, n, err
+	}
+	return shash.Sum(make([]byte, 0, shash.Size())), n, nil
+}
+
+// the cache of previously-computed hashes, if --cache was given
+var hcache *hashCache
+
+// cachedHashFile computes the full hash of a file, consulting the
+// hash cache (if any) to skip unchanged files.  It also gives the
+// number of bytes read, which is 0 when the cache had the answer.
+func cachedHashFile(fname string, bits int) ([]byte, int64, error) {
+	if hcache == nil || fname == "-" {
+		return hashFile(fname, bits, -1)
+	}
+
+	key, ent, err := describe(fname, bits)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !rehash {
+		if digest, ok := hcache.lookup(key, ent); ok {
+			progress.skip(ent.Size)
+			return digest, 0, nil
 		}
-		defer inFile.Close()
 	}
 
-	shash := spritz.NewHash(bitSize)
-	if _, err = io.Copy(shash, inFile); err != nil {
+	var n int64
+	if ent.Digest, n, err = hashFile(fname, bits, -1); err != nil {
+		return nil, n, err
+	}
+	hcache.store(key, ent)
+	return ent.Digest, n, nil
+}
+
+// hash performs the actual hash, and prints out the result.
+func hash(fname string, rep *fileReport) (err error) {
+	computed, n, err := cachedHashFile(fname, bitSize)
+	rep.BytesRead = n
+	if err != nil {
 		return
 	}
 
-	computed := shash.Sum(make([]byte, 0, byteSize))
 	if asHex {
-		fmt.Printf("%s: %x\n", fname, computed)
+		rep.Digest = fmt.Sprintf("%x", computed)
 	} else {
-		fmt.Printf("%s: %s\n", fname, base64.StdEncoding.EncodeToString(computed))
+		rep.Digest = base64.StdEncoding.EncodeToString(computed)
+	}
+
+	if fname == "-" {
+		fname = ""
 	}
+	fmt.Printf("%s: %s\n", fname, rep.Digest)
 	return
 }
 
 func hashRoutine(input chan string, errs chan uint64) {
 	var errCount uint64
 	for fname := range input {
-		if err := hash(fname); err != nil {
+		if ctx.Err() != nil {
+			// interrupted, so don't start anything new
+			report.notStarted(fname)
+			errCount++
+			continue
+		}
+
+		rep := startFile(fname)
+		err := hash(fname, rep)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Hashing %s: %v\n", fname, err)
 			errCount++
 		}
+		progress.finish(fname, err)
+		report.done(rep, err)
 	}
 	errs <- errCount
 }
 
 func hashMain() {
-	var errCount uint64
+	var errCount uint64 // errors not tied to any one file
+	var fileErrs uint64
 
 	cmdSet := flag.NewFlagSet("hash", flag.ExitOnError)
 	cmdSet.IntVar(&bitSize, "size", 256, "size of the hash in bits")
@@ -67,8 +132,23 @@ func hashMain() {
 	cmdSet.BoolVar(&asHex, "h", false, "shorthand for --hex")
 	cmdSet.IntVar(&jobs, "jobs", 8, "number of concurrent hashes to compute")
 	cmdSet.IntVar(&jobs, "j", 8, "shorthand for --jobs")
+	cmdSet.StringVar(&cacheFile, "cache", "", "file to cache hashes of unchanged files")
+	cmdSet.BoolVar(&rehash, "rehash", false, "recompute all hashes, even if cached")
+	cmdSet.BoolVar(&showProgress, "progress", false, "show progress on stderr")
+	cmdSet.BoolVar(&showStats, "stats", false, "print a summary when done")
+	cmdSet.StringVar(&reportFile, "report", "", "write a JSON report of the run to this file")
 	cmdSet.Parse(os.Args[2:])
 
+	if len(cacheFile) > 0 {
+		var err error
+		if hcache, err = loadHashCache(cacheFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Loading cache %s: %v\n", cacheFile, err)
+			os.Exit(1)
+		}
+	}
+
+	cancelOnInterrupt()
+	startProgress()
 	input, errs := make(chan string, jobs), make(chan uint64, jobs)
 	for idx := 0; idx < jobs; idx++ {
 		go hashRoutine(input, errs)
@@ -87,8 +167,12 @@ func hashMain() {
 			if err != nil {
 				return err
 			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
 
 			if fi.Mode().IsRegular() {
+				progress.addTotal(fi.Size())
 				input <- fname
 			}
 			return nil
@@ -103,9 +187,17 @@ func hashMain() {
 	// close the input channel and collect the worker goroutines' error counts.
 	close(input)
 	for idx := 0; idx < jobs; idx++ {
-		errCount += <-errs
+		fileErrs += <-errs
+	}
+	progress.close()
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted: %d files failed or were not hashed, and the rest of the tree was skipped\n", fileErrs)
 	}
-	if errCount > 0 {
-		os.Exit(1)
+	if hcache != nil {
+		if err := hcache.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Saving cache %s: %v\n", cacheFile, err)
+			errCount++
+		}
 	}
+	report.finish("hash", errCount)
 }
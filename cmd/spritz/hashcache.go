@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cacheEntry records what a file looked like when it was hashed,
+// along with the digest computed at the time.
+type cacheEntry struct {
+	Size   int64
+	MTime  int64 // modification time, in unix nanoseconds
+	Inode  uint64
+	Bits   int
+	Digest []byte
+}
+
+// hashCache is a database of previously-computed digests, keyed by
+// absolute path.  Only the files seen in a run are kept when it is
+// saved, so entries for deleted and renamed files don't pile up.  It
+// is safe to use from multiple goroutines.
+type hashCache struct {
+	fname   string
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	seen    map[string]bool // the keys looked up or stored in this run
+	dirty   bool
+}
+
+// loadHashCache reads the cache from the named file. A missing file
+// just gives an empty cache.
+func loadHashCache(fname string) (*hashCache, error) {
+	hc := &hashCache{fname: fname, entries: make(map[string]cacheEntry), seen: make(map[string]bool)}
+
+	data, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return hc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &hc.entries); err != nil {
+		return nil, err
+	}
+	return hc, nil
+}
+
+// describe builds the cache entry (minus the digest) for a file.
+func describe(fname string, bits int) (key string, ent cacheEntry, err error) {
+	if key, err = filepath.Abs(fname); err != nil {
+		return
+	}
+
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return
+	}
+
+	ent = cacheEntry{
+		Size:  fi.Size(),
+		MTime: fi.ModTime().UnixNano(),
+		Inode: fileInode(fi),
+		Bits:  bits,
+	}
+	return
+}
+
+// lookup gives the cached digest for the file, if the file is unchanged
+// since it was hashed.
+func (hc *hashCache) lookup(key string, ent cacheEntry) ([]byte, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	hc.seen[key] = true
+	old, ok := hc.entries[key]
+	if !ok || old.Size != ent.Size || old.MTime != ent.MTime ||
+		old.Inode != ent.Inode || old.Bits != ent.Bits {
+		return nil, false
+	}
+	return old.Digest, true
+}
+
+// store records a newly-computed digest.
+func (hc *hashCache) store(key string, ent cacheEntry) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	hc.entries[key] = ent
+	hc.seen[key] = true
+	hc.dirty = true
+}
+
+// save drops the entries not seen in this run, and writes the cache
+// back out if it changed, going through a temporary file so that an
+// interrupted save can't corrupt it.
+func (hc *hashCache) save() error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	for key := range hc.entries {
+		if !hc.seen[key] {
+			delete(hc.entries, key)
+			hc.dirty = true
+		}
+	}
+	if !hc.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(hc.entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := hc.fname + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, hc.fname); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	hc.dirty = false
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import "os"
+
+// fileInode gives 0 on windows, which has no inode numbers in
+// os.FileInfo.  Size and modification time still guard the cache.
+func fileInode(fi os.FileInfo) uint64 {
+	return 0
+}
+
+// fileOwner gives -1 on windows, whose files have no user ids.
+func fileOwner(fi os.FileInfo) int {
+	return -1
+}
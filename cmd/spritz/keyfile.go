@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var keyFile string // a file holding the password, for unattended use
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// readKeyFile reads the password kept in a key file: the whole file,
+// less any trailing newline.  Like ssh, we refuse a key file that
+// other users can read.
+func readKeyFile(fname string) (string, error) {
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("key file %s is readable by others (chmod 600 it)", fname)
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimRight(string(data), "\r\n")
+	if len(key) == 0 {
+		return "", errors.New("key file " + fname + " is empty")
+	}
+	return key, nil
+}
+
+// keyFileName gives the key file from --key-file, or $SPRITZ_KEY_FILE.
+func keyFileName() string {
+	if len(keyFile) > 0 {
+		return keyFile
+	}
+	return os.Getenv("SPRITZ_KEY_FILE")
+}
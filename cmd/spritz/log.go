@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rwtodd/Go.Spritz/spritz/elog"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var logName string // the name of the log in its directory
+var showMeta bool  // print the sequence number and time of records?
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// describeLog summarizes a report from elog.Read.
+func describeLog(rep elog.Report) string {
+	desc := fmt.Sprintf("%d records in %d segments, sequence %d to %d", rep.Records, rep.Segments, rep.First, rep.Last)
+	if rep.First > 0 {
+		desc += " (earlier segments were removed)"
+	}
+	switch {
+	case rep.Restarts == 1:
+		desc += ", 1 restart"
+	case rep.Restarts > 1:
+		desc += fmt.Sprintf(", %d restarts", rep.Restarts)
+	}
+	if rep.Dropped > 0 {
+		desc += fmt.Sprintf(", %d bytes of half-written records dropped", rep.Dropped)
+	}
+	return desc
+}
+
+func logUsage(cmdSet *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "Usage: spritz log (cat|verify) DIR [flags]")
+	fmt.Fprintln(os.Stderr, "  cat prints the records of the log; verify checks it for")
+	fmt.Fprintln(os.Stderr, "  damage, and for missing or reordered records")
+	cmdSet.PrintDefaults()
+	os.Exit(exitUsage)
+}
+
+func logMain() {
+	cmdSet := flag.NewFlagSet("log", flag.ExitOnError)
+	cmdSet.StringVar(&logName, "name", "log", "the name of the log, which starts its segment files")
+	cmdSet.StringVar(&logName, "n", "log", "shorthand for --name")
+	cmdSet.StringVar(&pw, "password", "", "the password of the log")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&keyFile, "key-file", "", "read the password from this file")
+	cmdSet.BoolVar(&showMeta, "meta", false, "with cat, start each record with its sequence number and time")
+	cmdSet.BoolVar(&showMeta, "m", false, "shorthand for --meta")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) != 2 || (args[0] != "cat" && args[0] != "verify") {
+		logUsage(cmdSet)
+	}
+	op, dir := args[0], args[1]
+
+	var err error
+	if len(pw) == 0 {
+		if pw, err = getPassword("Password: ", 1); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var show func(elog.Record) error
+	out := bufio.NewWriter(os.Stdout)
+	if op == "cat" {
+		show = func(r elog.Record) error {
+			if !showMeta {
+				_, err := out.Write(r.Data)
+				return err
+			}
+			fmt.Fprintf(out, "%d %s ", r.Seq, r.Time.Format(time.RFC3339Nano))
+			out.Write(r.Data)
+			if len(r.Data) == 0 || r.Data[len(r.Data)-1] != '\n' {
+				out.WriteByte('\n')
+			}
+			return nil
+		}
+	}
+
+	var rep elog.Report
+	_, err = withPassword(defaultSlot, "Password: ", pw, func(pw string) (err error) {
+		rep, err = elog.Read(dir, logName, pw, show)
+		return
+	})
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", dir, checkFailure(err))
+		if rep.Segments > 0 {
+			fmt.Fprintf(os.Stderr, "read %s before the problem\n", describeLog(rep))
+		}
+		os.Exit(exitFailure)
+	}
+	if op == "verify" {
+		fmt.Printf("%s: ok, %s\n", dir, describeLog(rep))
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/rwtodd/Go.AppUtil/cmdline"
 )
@@ -12,11 +16,79 @@ import (
 // ----------------------
 var jobs int
 
+// ctx is cancelled when the user interrupts a command that
+// supports it, so the workers can stop cleanly.
+var ctx = context.Background()
+
+// cancelOnInterrupt arranges for ctx to be cancelled on the first
+// SIGINT or SIGTERM.  A second one exits immediately.
+func cancelOnInterrupt() {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Fprintln(os.Stderr, "Interrupted: cleaning up (interrupt again to quit now)")
+		cancel()
+		<-sigs
+		os.Exit(130)
+	}()
+}
+
+// parseInterspersed parses the args with the flagset, allowing flags
+// to come after positional arguments (e.g., "pack DIR -o out.spa").
+// It returns the positional arguments.
+func parseInterspersed(cmdSet *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		cmdSet.Parse(args)
+		args = cmdSet.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return positional
+}
+
+// readPassword gets the password from the agent, or prompts for one
+// (asking times times, to confirm it), and exits if it can't get a
+// non-empty one.
+func readPassword(prompt string, times int) string {
+	pw, err := getPassword(prompt, times)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+		os.Exit(1)
+	}
+	if len(pw) == 0 {
+		fmt.Fprintf(os.Stderr, "Missing password.\n")
+		os.Exit(2)
+	}
+	return pw
+}
+
 func usage() {
-	fmt.Fprintln(os.Stderr, "Usage:  spritz (hash|crypt|repass) [args...]")
+	fmt.Fprintln(os.Stderr, "Usage:  spritz (hash|crypt|repass|dupes|pack|unpack|cat|edit|agent|vault|pwgen|split|recover|backup-key|restore-key|log|git-filter|git-textconv) [args...]")
 	fmt.Fprintln(os.Stderr, "Commands:  hash   compute the hash of inputs")
 	fmt.Fprintln(os.Stderr, "           crypt  encrypt or decrypt inputs")
 	fmt.Fprintln(os.Stderr, "           repass change password on files")
+	fmt.Fprintln(os.Stderr, "           dupes  find duplicate files")
+	fmt.Fprintln(os.Stderr, "           pack   encrypt a directory into one archive")
+	fmt.Fprintln(os.Stderr, "           unpack list or extract a packed archive")
+	fmt.Fprintln(os.Stderr, "           cat    decrypt files to stdout")
+	fmt.Fprintln(os.Stderr, "           edit   edit an encrypted file in $EDITOR")
+	fmt.Fprintln(os.Stderr, "           agent  cache passwords for the other commands")
+	fmt.Fprintln(os.Stderr, "           vault  keep named secrets in one encrypted file")
+	fmt.Fprintln(os.Stderr, "           pwgen  generate passwords and passphrases")
+	fmt.Fprintln(os.Stderr, "           split  split a file's key into shares for recovery")
+	fmt.Fprintln(os.Stderr, "           recover  give a file a new password, from its key shares")
+	fmt.Fprintln(os.Stderr, "           backup-key  print a recovery code for a file")
+	fmt.Fprintln(os.Stderr, "           restore-key give a file a new password, from its recovery code")
+	fmt.Fprintln(os.Stderr, "           log    read and verify encrypted logs")
+	fmt.Fprintln(os.Stderr, "           git-filter, git-textconv  keep files encrypted in git")
 	fmt.Fprintln(os.Stderr, "  Give '-help' arg for further help on a command")
 	os.Exit(2)
 }
@@ -35,6 +107,36 @@ func main() {
 		cryptMain()
 	case "repass":
 		repassMain()
+	case "dupes":
+		dupesMain()
+	case "pack":
+		packMain()
+	case "unpack":
+		unpackMain()
+	case "cat":
+		catMain()
+	case "edit":
+		editMain()
+	case "agent":
+		agentMain()
+	case "vault":
+		vaultMain()
+	case "pwgen":
+		pwgenMain()
+	case "split":
+		splitMain()
+	case "recover":
+		recoverMain()
+	case "backup-key":
+		backupKeyMain()
+	case "restore-key":
+		restoreKeyMain()
+	case "log":
+		logMain()
+	case "git-filter":
+		gitFilterMain()
+	case "git-textconv":
+		gitTextconvMain()
 	default:
 		usage()
 	}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var force bool     // overwrite existing outputs?
+var noClobber bool // silently skip existing outputs?
+var useSuffix bool // pick a new name for existing outputs?
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// errExists is reported when an output file is already there, and
+// no policy says what to do about it.
+var errExists = errors.New("output exists (use --force, --no-clobber or --suffix)")
+
+// the outputs claimed so far in this run, so that two inputs which map
+// to the same output (a.txt and a.md both become a.dat) can't collide.
+var claimedMu sync.Mutex
+var claimed = make(map[string]bool)
+
+// checkPolicy makes sure at most one of the overwrite policies was given.
+func checkPolicy() error {
+	count := 0
+	for _, b := range []bool{force, noClobber, useSuffix} {
+		if b {
+			count++
+		}
+	}
+	if count > 1 {
+		return errors.New("give at most one of --force, --no-clobber and --suffix")
+	}
+	return nil
+}
+
+// claimOutput decides the final name of an output file, according to
+// the overwrite policy in effect. An empty name with no error means the
+// output should be skipped.
+func claimOutput(name string) (string, error) {
+	claimedMu.Lock()
+	defer claimedMu.Unlock()
+
+	taken := func(n string) bool {
+		if claimed[n] {
+			return true
+		}
+		_, err := os.Lstat(n)
+		return err == nil
+	}
+
+	if taken(name) {
+		switch {
+		case force && !claimed[name]:
+			// overwriting an old file is fine, but not one of our own outputs
+		case noClobber:
+			return "", nil
+		case useSuffix || force:
+			ext := filepath.Ext(name)
+			base := strings.TrimSuffix(name, ext)
+			for idx := 1; ; idx++ {
+				cand := fmt.Sprintf("%s.%d%s", base, idx, ext)
+				if !taken(cand) {
+					name = cand
+					break
+				}
+			}
+		default:
+			return "", errExists
+		}
+	}
+
+	claimed[name] = true
+	return name, nil
+}
+
+// atomicFile is an output file that is written under a temporary name,
+// and only moved into place once it is complete.
+type atomicFile struct {
+	*os.File
+	final string
+	done  bool
+}
+
+// createAtomic creates a temporary file next to the final name.
+func createAtomic(final string) (*atomicFile, error) {
+	dir, base := filepath.Dir(final), filepath.Base(final)
+	for idx := 0; ; idx++ {
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.%d-%d.tmp", base, os.Getpid(), idx))
+		fl, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &atomicFile{File: fl, final: final}, nil
+	}
+}
+
+// Commit flushes the file to disk and renames it to its final name.
+func (af *atomicFile) Commit() error {
+	af.done = true
+	err1 := af.Sync()
+	err2 := af.Close()
+	if err1 == nil {
+		err1 = err2
+	}
+	if err1 == nil {
+		err1 = os.Rename(af.Name(), af.final)
+	}
+	if err1 != nil {
+		os.Remove(af.Name())
+	}
+	return err1
+}
+
+// Abort removes the temporary file, unless it was already committed.
+// It is meant to be deferred right after createAtomic.
+func (af *atomicFile) Abort() {
+	if af.done {
+		return
+	}
+	af.done = true
+	af.Close()
+	os.Remove(af.Name())
+}
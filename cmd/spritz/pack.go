@@ -0,0 +1,342 @@
+package main
+
+import (
+	"archive/tar"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var packOut string   // the archive to create
+var unpackDir string // where to extract files
+var listOnly bool    // only list the archive contents?
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// packDir streams a tar of the directory into the writer.  The
+// names in the archive start with the base name of the directory.
+// Files in skip (absolute paths, such as the archive being written)
+// are left out.
+func packDir(tw *tar.Writer, dir string, skip map[string]bool) error {
+	top := filepath.Base(filepath.Clean(dir))
+
+	return filepath.Walk(dir, func(fname string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if abs, err := filepath.Abs(fname); err == nil && skip[abs] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, fname)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(fname); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(top, filepath.ToSlash(rel))
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		inFile, err := os.Open(fname)
+		if err != nil {
+			return err
+		}
+		defer inFile.Close()
+
+		_, err = io.Copy(tw, inFile)
+		return err
+	})
+}
+
+func packMain() {
+	cmdSet := flag.NewFlagSet("pack", flag.ExitOnError)
+	cmdSet.StringVar(&pw, "password", "", "the password to use for encryption")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&packOut, "output", "", "the archive to create (default DIR.spa)")
+	cmdSet.StringVar(&packOut, "o", "", "shorthand for --output")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Give exactly one directory to pack!")
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+	dir := args[0]
+	if len(packOut) == 0 {
+		packOut = filepath.Clean(dir) + ".spa"
+	}
+
+	if len(pw) == 0 {
+		pw = readPassword("Password: ", 2)
+	}
+
+	if err := pack(pw, dir, packOut); err != nil {
+		fmt.Fprintf(os.Stderr, "Packing %s: %v\n", dir, err)
+		os.Exit(exitFailure)
+	}
+}
+
+// pack encrypts a tar of dir into the file out.  No name is
+// embedded, so nothing about the contents leaks.  The archive only
+// replaces out once it is complete.
+func pack(pw, dir, out string) error {
+	fmt.Printf("%s -> %s\n", dir, out)
+	atomic, err := createAtomic(out)
+	if err != nil {
+		return err
+	}
+	defer atomic.Abort()
+
+	// the archive may be inside dir, so don't pack it into itself
+	skip := make(map[string]bool)
+	for _, fname := range []string{out, atomic.Name()} {
+		if abs, err := filepath.Abs(fname); err == nil {
+			skip[abs] = true
+		}
+	}
+
+	writer, err := spritz.WrapWriterVersion(atomic, pw, "", spritz.HeaderV2)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(writer)
+	if err = packDir(tw, dir, skip); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return atomic.Commit()
+}
+
+// wanted tells if the archive entry is one the user asked for. An
+// empty list means everything is wanted, and naming a directory
+// selects everything under it.
+func wanted(name string, selected []string) bool {
+	if len(selected) == 0 {
+		return true
+	}
+	name = strings.TrimSuffix(name, "/")
+	for _, sel := range selected {
+		sel = strings.TrimSuffix(filepath.ToSlash(sel), "/")
+		if name == sel || strings.HasPrefix(name, sel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// escapes tells if a slash-separated path would leave the directory
+// it is relative to.
+func escapes(name string) bool {
+	name = path.Clean(name)
+	return path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../")
+}
+
+// checkParents makes sure that none of the directories leading to
+// the slash-separated name under dest is a symlink, so that nothing
+// is written through a link extracted earlier (or planted beforehand).
+func checkParents(dest, name string) error {
+	dir := ""
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if part == "." {
+			continue
+		}
+		dir = path.Join(dir, part)
+		fi, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(dir)))
+		if os.IsNotExist(err) {
+			return nil // MkdirAll will make the rest
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("won't extract through the symlink %s", dir)
+		}
+	}
+	return nil
+}
+
+// claimTarget applies the overwrite policy to an entry's target.  It
+// removes a file that --force replaces, so the new one can be created
+// without following a symlink there.  An empty name means skip it.
+func claimTarget(target string) (string, error) {
+	final, err := claimOutput(target)
+	if err != nil || final != target {
+		return final, err
+	}
+	if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+		if err = os.Remove(target); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// extractEntry writes one archive entry under the destination
+// directory.  Entries (or symlinks) that would land outside of it,
+// or be written through a symlink, are refused.
+func extractEntry(tr *tar.Reader, hdr *tar.Header, dest string) error {
+	name := path.Clean(hdr.Name)
+	if escapes(name) {
+		return fmt.Errorf("unsafe path in archive: %s", hdr.Name)
+	}
+	if err := checkParents(dest, name); err != nil {
+		return err
+	}
+	target := filepath.Join(dest, filepath.FromSlash(name))
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+			return fmt.Errorf("%s exists, and isn't a directory", target)
+		}
+		return os.MkdirAll(target, os.FileMode(hdr.Mode).Perm()|0700)
+	case tar.TypeSymlink:
+		if path.IsAbs(hdr.Linkname) || escapes(path.Join(path.Dir(name), hdr.Linkname)) {
+			return fmt.Errorf("unsafe link in archive: %s -> %s", hdr.Name, hdr.Linkname)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		target, err := claimTarget(target)
+		if err != nil || len(target) == 0 {
+			return err
+		}
+		return os.Symlink(hdr.Linkname, target)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		target, err := claimTarget(target)
+		if err != nil || len(target) == 0 {
+			return err
+		}
+		outFile, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+
+		_, err = io.Copy(outFile, tr)
+		return err
+	default:
+		return fmt.Errorf("unsupported entry type %c for %s", hdr.Typeflag, hdr.Name)
+	}
+}
+
+// unpack lists or extracts the selected entries from an archive made
+// by pack.
+func unpack(pw, fn string, selected []string) (errCount uint64, err error) {
+	var inFile *os.File
+	var reader io.Reader
+	_, err = withPassword(defaultSlot, "Password: ", pw, func(pw string) error {
+		if inFile != nil {
+			inFile.Close() // from a try with the wrong password
+		}
+		if inFile, err = os.Open(fn); err != nil {
+			return err
+		}
+		reader, _, err = spritz.WrapReader(inFile, pw)
+		return err
+	})
+	if inFile != nil {
+		defer inFile.Close()
+	}
+	if err != nil {
+		return
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			return errCount, nil
+		}
+		if err != nil {
+			return
+		}
+
+		if !wanted(hdr.Name, selected) {
+			continue
+		}
+
+		if listOnly {
+			fmt.Printf("%s %10d %s\n", hdr.FileInfo().Mode(), hdr.Size, hdr.Name)
+			continue
+		}
+
+		fmt.Println(hdr.Name)
+		if xerr := extractEntry(tr, hdr, unpackDir); xerr != nil {
+			fmt.Fprintf(os.Stderr, "Extracting %s: %v\n", hdr.Name, xerr)
+			errCount++
+		}
+	}
+}
+
+func unpackMain() {
+	cmdSet := flag.NewFlagSet("unpack", flag.ExitOnError)
+	cmdSet.StringVar(&pw, "password", "", "the password to use for decryption")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&unpackDir, "dir", ".", "the directory to extract into")
+	cmdSet.StringVar(&unpackDir, "C", ".", "shorthand for --dir")
+	cmdSet.BoolVar(&listOnly, "list", false, "list the contents instead of extracting")
+	cmdSet.BoolVar(&listOnly, "l", false, "shorthand for --list")
+	cmdSet.BoolVar(&force, "force", false, "overwrite existing files")
+	cmdSet.BoolVar(&force, "f", false, "shorthand for --force")
+	cmdSet.BoolVar(&noClobber, "no-clobber", false, "skip entries whose file exists")
+	cmdSet.BoolVar(&noClobber, "n", false, "shorthand for --no-clobber")
+	cmdSet.BoolVar(&useSuffix, "suffix", false, "add a numeric suffix to entries that would overwrite a file")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "No archive given!")
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+	if err := checkPolicy(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if len(pw) == 0 {
+		pw = readPassword("Password: ", 1)
+	}
+
+	errCount, err := unpack(pw, args[0], args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unpacking %s: %v\n", args[0], err)
+		errCount++
+	}
+	if errCount > 0 {
+		os.Exit(exitFailure)
+	}
+}
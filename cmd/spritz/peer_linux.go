@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerUID gives the user id of the process at the other end of a
+// unix socket, from SO_PEERCRED.
+func peerUID(conn net.Conn) (int, bool) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var cred *syscall.Ucred
+	var cerr error
+	err = raw.Control(func(fd uintptr) {
+		cred, cerr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cerr != nil {
+		return 0, false
+	}
+	return int(cred.Uid), true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwtodd/Go.Spritz/spritz/strength"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var minStrength string    // the weakest password to accept for encryption
+var strengthAction string // what to do about weaker ones: warn or refuse
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// the name of the team config file, looked for in the current
+// directory and its parents
+const configName = ".spritz.json"
+
+// teamConfig holds the settings a team can share in a config file.
+type teamConfig struct {
+	MinStrength    string `json:"min_strength"`
+	StrengthAction string `json:"strength_action"` // warn or refuse
+}
+
+// findConfig gives the config file in effect: $SPRITZ_CONFIG, or the
+// nearest .spritz.json up from the current directory, or the one in
+// the user's config directory.  It gives "" if there isn't one.
+func findConfig() string {
+	if path := os.Getenv("SPRITZ_CONFIG"); len(path) > 0 {
+		return path
+	}
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			path := filepath.Join(dir, configName)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		path := filepath.Join(dir, "spritz", "config.json")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads the config file, if there is one.
+func loadConfig() (teamConfig, error) {
+	var cfg teamConfig
+	path := findConfig()
+	if len(path) == 0 {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// addStrengthFlags sets up the flags for the password policy.
+func addStrengthFlags(cmdSet *flag.FlagSet) {
+	cmdSet.StringVar(&minStrength, "min-strength", "", "weakest new password to accept: very-weak, weak, fair, strong or very-strong")
+	cmdSet.StringVar(&strengthAction, "strength-action", "", "what to do with weaker passwords: warn or refuse (default warn)")
+}
+
+// checkStrength applies the password policy, from the flags or else
+// the config file, to a new password.  It prints a warning or gives
+// an error, as the policy says.
+func checkStrength(pw string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if len(minStrength) == 0 {
+		minStrength = cfg.MinStrength
+	}
+	if len(strengthAction) == 0 {
+		strengthAction = cfg.StrengthAction
+	}
+	if len(minStrength) == 0 {
+		return nil
+	}
+
+	min, err := strength.ParseLevel(minStrength)
+	if err != nil {
+		return err
+	}
+	refuse := false
+	switch strengthAction {
+	case "", "warn":
+	case "refuse":
+		refuse = true
+	default:
+		return fmt.Errorf("unknown strength action %q: want warn or refuse", strengthAction)
+	}
+
+	res := strength.Estimate(pw)
+	if res.Level >= min {
+		return nil
+	}
+	msg := fmt.Sprintf("the password is %v (about %.0f bits), below the minimum of %v", res.Level, res.Bits, min)
+	if len(res.Warnings) > 0 {
+		msg += ": " + strings.Join(res.Warnings, "; ")
+	}
+	if refuse {
+		return fmt.Errorf("%s", msg)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var showProgress bool // show a running progress line on stderr?
+var showStats bool    // print a summary at the end of the run?
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// how often the progress line is redrawn
+const progressInterval = 500 * time.Millisecond
+
+// fileProgress is the state of one file being worked on.
+type fileProgress struct {
+	done, size int64
+}
+
+// tracker keeps the statistics for a run, shared by all of the
+// worker goroutines.  A nil *tracker is valid, and tracks nothing.
+type tracker struct {
+	// the atomically-updated counters come first, to keep them
+	// 64-bit aligned on 32-bit platforms
+	totalBytes int64 // bytes expected, across all files
+	doneBytes  int64 // bytes read so far
+	files      uint64
+	errs       uint64
+	start      time.Time
+
+	mu     sync.Mutex
+	active map[string]*fileProgress
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// the tracker for this run, if --progress or --stats was given
+var progress *tracker
+
+// isTerminal tells if the file is a character device, which is as
+// close as we can get to "a terminal" without any extra packages.
+func isTerminal(fl *os.File) bool {
+	fi, err := fl.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress sets up the tracker, if the flags asked for one.  The
+// running display is only shown when stderr is a terminal.
+func startProgress() {
+	if !showProgress && !showStats {
+		return
+	}
+
+	progress = &tracker{
+		start:  time.Now(),
+		active: make(map[string]*fileProgress),
+		stop:   make(chan struct{}),
+	}
+
+	if showProgress && isTerminal(os.Stderr) {
+		progress.wg.Add(1)
+		go progress.display()
+	}
+}
+
+// addTotal adds to the number of bytes we expect to process.
+func (t *tracker) addTotal(size int64) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.totalBytes, size)
+}
+
+// skip takes a file out of the expected total, when it turns
+// out we don't have to read it after all.
+func (t *tracker) skip(size int64) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.totalBytes, -size)
+}
+
+// wrap sets up the tracking of a file, returning a reader which
+// counts the bytes as they are read.
+func (t *tracker) wrap(name string, fl *os.File) io.Reader {
+	if t == nil {
+		return fl
+	}
+
+	fp := new(fileProgress)
+	if fi, err := fl.Stat(); err == nil && fi.Mode().IsRegular() {
+		fp.size = fi.Size()
+	}
+
+	t.mu.Lock()
+	t.active[name] = fp
+	t.mu.Unlock()
+
+	return &spritz.ProgressReader{R: fl, Report: func(n int) {
+		atomic.AddInt64(&fp.done, int64(n))
+		atomic.AddInt64(&t.doneBytes, int64(n))
+	}}
+}
+
+// finish records the outcome of a file.
+func (t *tracker) finish(name string, err error) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	delete(t.active, name)
+	t.mu.Unlock()
+
+	atomic.AddUint64(&t.files, 1)
+	if err != nil {
+		atomic.AddUint64(&t.errs, 1)
+	}
+}
+
+// display redraws the progress line until the tracker is closed.
+func (t *tracker) display() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", 79))
+			return
+		case <-ticker.C:
+			line := t.line()
+			if len(line) > 79 {
+				line = line[:79]
+			}
+			fmt.Fprintf(os.Stderr, "\r%-79s", line)
+		}
+	}
+}
+
+// line describes the progress so far: the aggregate bytes, rate and
+// ETA, then the percent done of each active file.
+func (t *tracker) line() string {
+	done, total := atomic.LoadInt64(&t.doneBytes), atomic.LoadInt64(&t.totalBytes)
+	elapsed := time.Since(t.start).Seconds()
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(done) / elapsed
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s", humanBytes(done))
+	if total > 0 {
+		fmt.Fprintf(&sb, "/%s", humanBytes(total))
+	}
+	fmt.Fprintf(&sb, " %s/s", humanBytes(int64(rate)))
+	if total > done && rate > 0 {
+		eta := time.Duration(float64(total-done)/rate) * time.Second
+		fmt.Fprintf(&sb, " ETA %v", eta)
+	}
+
+	t.mu.Lock()
+	names := make([]string, 0, len(t.active))
+	for name := range t.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fp := t.active[name]
+		if fp.size > 0 {
+			fmt.Fprintf(&sb, " | %s %d%%", filepath.Base(name), atomic.LoadInt64(&fp.done)*100/fp.size)
+		} else {
+			fmt.Fprintf(&sb, " | %s %s", filepath.Base(name), humanBytes(atomic.LoadInt64(&fp.done)))
+		}
+	}
+	t.mu.Unlock()
+
+	return sb.String()
+}
+
+// close stops the display, and prints the summary if --stats was given.
+func (t *tracker) close() {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	t.wg.Wait()
+
+	if showStats {
+		elapsed := time.Since(t.start)
+		done := atomic.LoadInt64(&t.doneBytes)
+		fmt.Fprintf(os.Stderr, "%d files, %s, %d errors in %v (%s/s)\n",
+			atomic.LoadUint64(&t.files), humanBytes(done), atomic.LoadUint64(&t.errs),
+			elapsed.Round(time.Millisecond), humanBytes(int64(float64(done)/elapsed.Seconds())))
+	}
+}
+
+// humanBytes formats a byte count with binary units.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var pwLength int     // characters in a password
+var pwClasses string // character classes: l, u, d and s
+var pwWords int      // words in a passphrase, or 0 for a password
+var pwSep string     // the separator between words
+var pwCount int      // how many to generate
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// the character classes, by their letters in --classes
+var charClasses = map[rune]string{
+	'l': "abcdefghijklmnopqrstuvwxyz",
+	'u': "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	'd': "0123456789",
+	's': "!#$%&()*+,-./:;<=>?@[]^_{|}~",
+}
+
+// genPassword makes a password of length characters, with at least
+// one from each class.
+func genPassword(rnd *spritz.Random, length int, classes []string) (string, error) {
+	alphabet := strings.Join(classes, "")
+	pw := make([]byte, length)
+	for {
+		for idx := range pw {
+			n, err := rnd.Intn(len(alphabet))
+			if err != nil {
+				return "", err
+			}
+			pw[idx] = alphabet[n]
+		}
+
+		// try again if a class is missing, which keeps the
+		// choice uniform among the passwords that qualify
+		complete := true
+		for _, class := range classes {
+			complete = complete && strings.ContainsAny(string(pw), class)
+		}
+		if complete {
+			return string(pw), nil
+		}
+	}
+}
+
+// genPassphrase picks words from the wordlist.
+func genPassphrase(rnd *spritz.Random, words int, sep string) (string, error) {
+	chosen := make([]string, words)
+	for idx := range chosen {
+		n, err := rnd.Intn(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		chosen[idx] = wordlist[n]
+	}
+	return strings.Join(chosen, sep), nil
+}
+
+func pwgenMain() {
+	cmdSet := flag.NewFlagSet("pwgen", flag.ExitOnError)
+	cmdSet.IntVar(&pwLength, "length", 20, "characters in each password")
+	cmdSet.IntVar(&pwLength, "l", 20, "shorthand for --length")
+	cmdSet.StringVar(&pwClasses, "classes", "luds", "character classes: l(ower), u(pper), d(igits), s(ymbols)")
+	cmdSet.StringVar(&pwClasses, "c", "luds", "shorthand for --classes")
+	cmdSet.IntVar(&pwWords, "words", 0, "make a passphrase of this many words instead")
+	cmdSet.IntVar(&pwWords, "w", 0, "shorthand for --words")
+	cmdSet.StringVar(&pwSep, "sep", "-", "separator between the words of a passphrase")
+	cmdSet.IntVar(&pwCount, "count", 1, "how many to generate")
+	cmdSet.IntVar(&pwCount, "n", 1, "shorthand for --count")
+	cmdSet.Parse(os.Args[2:])
+
+	var classes []string
+	seen := make(map[rune]bool)
+	for _, letter := range pwClasses {
+		class, ok := charClasses[letter]
+		if !ok || seen[letter] {
+			fmt.Fprintf(os.Stderr, "Bad --classes %q: give some of l, u, d and s\n", pwClasses)
+			os.Exit(exitUsage)
+		}
+		seen[letter] = true
+		classes = append(classes, class)
+	}
+
+	var bits float64
+	switch {
+	case pwCount < 1 || pwWords < 0:
+		fmt.Fprintln(os.Stderr, "The --count and --words must be positive.")
+		os.Exit(exitUsage)
+	case pwWords > 0:
+		bits = float64(pwWords) * math.Log2(float64(len(wordlist)))
+	case len(classes) == 0 || pwLength < len(classes):
+		fmt.Fprintln(os.Stderr, "The --length must allow one character from each class.")
+		os.Exit(exitUsage)
+	default:
+		// a little high, since we insist on every class
+		bits = float64(pwLength) * math.Log2(float64(len(strings.Join(classes, ""))))
+	}
+
+	rnd := spritz.NewRandom()
+	for idx := 0; idx < pwCount; idx++ {
+		var pw string
+		var err error
+		if pwWords > 0 {
+			pw, err = genPassphrase(rnd, pwWords, pwSep)
+		} else {
+			pw, err = genPassword(rnd, pwLength, classes)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		fmt.Println(pw)
+	}
+
+	// on stderr, so the output can be piped
+	fmt.Fprintf(os.Stderr, "about %.0f bits of entropy each\n", bits)
+}
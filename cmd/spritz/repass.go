@@ -19,17 +19,21 @@ var npw string // the password for the new file
 func repassRoutine(input chan string, errs chan uint64) {
 	var errCount uint64
 	for fname := range input {
-		if err := spritz.RePasswd(opw, npw, fname); err != nil {
+		rep := startFile(fname)
+		rep.Output = fname
+		_, err := withPassword(defaultSlot, "Old Password: ", currentPassword(defaultSlot, opw), func(opw string) error {
+			return spritz.RePasswd(opw, npw, fname)
+		})
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Repass %s: %v\n", fname, err)
 			errCount++
 		}
+		report.done(rep, err)
 	}
 	errs <- errCount
 }
 
 func repassMain() {
-	var errCount uint64
-
 	cmdSet := flag.NewFlagSet("repass", flag.ExitOnError)
 	cmdSet.StringVar(&npw, "newpass", "", "the password to use for encryption")
 	cmdSet.StringVar(&npw, "np", "", "shorthand for --newpass")
@@ -37,12 +41,14 @@ func repassMain() {
 	cmdSet.StringVar(&opw, "op", "", "shorthand for --oldpass")
 	cmdSet.IntVar(&jobs, "jobs", 2, "number of concurrent files to work on")
 	cmdSet.IntVar(&jobs, "j", 2, "shorthand for --jobs")
+	cmdSet.StringVar(&reportFile, "report", "", "write a JSON report of the run to this file")
+	addStrengthFlags(cmdSet)
 	cmdSet.Parse(os.Args[2:])
 
 	if len(opw) == 0 {
 		var err error
 
-		opw, err = password.Read("Old Password: ", 1)
+		opw, err = getPassword("Old Password: ", 1)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
 			os.Exit(1)
@@ -59,6 +65,11 @@ func repassMain() {
 		}
 	}
 
+	if err := checkStrength(npw); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(exitUsage)
+	}
+
 	// for repass, you must have a file
 	files := cmdSet.Args()
 	if len(files) == 0 {
@@ -80,9 +91,12 @@ func repassMain() {
 	// close the input channel and collect the reported error counts
 	close(input)
 	for idx := 0; idx < jobs; idx++ {
-		errCount += <-errs
+		<-errs // the per-file errors are in the report
 	}
-	if errCount > 0 {
-		os.Exit(1)
+
+	// the agent's password is now the new one
+	if code := report.exitCode(0); code == exitOK {
+		agentPut(defaultSlot, npw)
 	}
+	report.finish("repass", 0)
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var reportFile string // where to write the JSON run report
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// exit codes for commands that process a list of files
+const (
+	exitOK       = 0
+	exitFailure  = 1 // failures of mixed or unknown kinds
+	exitUsage    = 2 // bad command-line arguments
+	exitPartial  = 3 // some inputs succeeded, others failed
+	exitPassword = 4 // every failure was a wrong password
+	exitIO       = 5 // every failure was an I/O error
+)
+
+// statuses and error types recorded in the report
+const (
+	statusOK         = "ok"
+	statusSkipped    = "skipped"
+	statusError      = "error"
+	statusNotStarted = "not_started"
+)
+
+// fileReport records what happened to one input.
+type fileReport struct {
+	Input        string  `json:"input"`
+	Output       string  `json:"output,omitempty"`
+	EmbeddedName string  `json:"embedded_name,omitempty"`
+	Digest       string  `json:"digest,omitempty"`
+	Status       string  `json:"status"`
+	ErrorType    string  `json:"error_type,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	BytesRead    int64   `json:"bytes_read"`
+	BytesWritten int64   `json:"bytes_written"`
+	Seconds      float64 `json:"seconds"`
+
+	start time.Time
+}
+
+// runReport collects the fileReports from all of the workers.
+type runReport struct {
+	Command string        `json:"command"`
+	Started time.Time     `json:"started"`
+	Results []*fileReport `json:"results"`
+	Exit    int           `json:"exit_code"`
+
+	mu sync.Mutex
+}
+
+// the report for this run.  It is always collected, since the
+// exit code depends on it, but only written out for --report.
+var report = &runReport{Started: time.Now()}
+
+// startFile begins the record for one input.
+func startFile(input string) *fileReport {
+	return &fileReport{Input: input, start: time.Now()}
+}
+
+// countReads wraps a reader so that the bytes read are recorded.
+func (fr *fileReport) countReads(r io.Reader) io.Reader {
+	return &spritz.ProgressReader{R: r, Report: func(n int) { fr.BytesRead += int64(n) }}
+}
+
+// countWriter records the bytes written through it.
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+// countWrites wraps a writer so that the bytes written are recorded.
+func (fr *fileReport) countWrites(w io.Writer) io.Writer {
+	return countWriter{w, &fr.BytesWritten}
+}
+
+// errorType classifies an error for the report and the exit code.
+func errorType(err error) string {
+	var pe *os.PathError
+	var le *os.LinkError
+	var errno syscall.Errno
+	switch {
+	case errors.Is(err, spritz.ErrBadPassword), errors.Is(err, spritz.ErrWrongPassword):
+		return "password"
+	case errors.Is(err, spritz.ErrCorruptHeader), errors.Is(err, spritz.ErrTruncatedHeader),
+		errors.Is(err, spritz.ErrTruncated), errors.Is(err, spritz.ErrUnsupported),
+		errors.Is(err, spritz.ErrBadArmor), errors.Is(err, spritz.ErrArmorChecksum):
+		return "corrupt"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, errExists):
+		return "exists"
+	case errors.Is(err, errVerify):
+		return "verify"
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF),
+		errors.As(err, &pe), errors.As(err, &le), errors.As(err, &errno):
+		return "io"
+	default:
+		return "other"
+	}
+}
+
+// done finishes the record for an input, and adds it to the report.
+func (r *runReport) done(fr *fileReport, err error) {
+	fr.Seconds = time.Since(fr.start).Seconds()
+	switch {
+	case err != nil:
+		fr.Status = statusError
+		fr.ErrorType = errorType(err)
+		fr.Error = err.Error()
+	case len(fr.Status) == 0:
+		fr.Status = statusOK
+	}
+
+	r.mu.Lock()
+	r.Results = append(r.Results, fr)
+	r.mu.Unlock()
+}
+
+// notStarted records an input that was never worked on, because the
+// run was interrupted.
+func (r *runReport) notStarted(input string) {
+	fr := startFile(input)
+	fr.Status = statusNotStarted
+	r.mu.Lock()
+	r.Results = append(r.Results, fr)
+	r.mu.Unlock()
+}
+
+// exitCode picks the exit status from the results, counting
+// otherErrs errors that didn't belong to any one input.
+func (r *runReport) exitCode(otherErrs uint64) int {
+	var good, bad int
+	kinds := make(map[string]bool)
+	for _, fr := range r.Results {
+		switch fr.Status {
+		case statusOK, statusSkipped:
+			good++
+		case statusNotStarted:
+			bad++
+			kinds["canceled"] = true
+		default:
+			bad++
+			kinds[fr.ErrorType] = true
+		}
+	}
+
+	switch {
+	case bad == 0 && otherErrs == 0:
+		return exitOK
+	case good > 0:
+		return exitPartial
+	case otherErrs == 0 && len(kinds) == 1 && kinds["password"]:
+		return exitPassword
+	case otherErrs == 0 && len(kinds) == 1 && kinds["io"]:
+		return exitIO
+	default:
+		return exitFailure
+	}
+}
+
+// finish writes the report if --report was given, and exits
+// with the appropriate status.
+func (r *runReport) finish(command string, otherErrs uint64) {
+	r.mu.Lock()
+	r.Command = command
+	r.Exit = r.exitCode(otherErrs)
+	r.mu.Unlock()
+
+	if len(reportFile) > 0 {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(reportFile, data, 0666)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Writing report %s: %v\n", reportFile, err)
+			if r.Exit == exitOK {
+				r.Exit = exitFailure
+			}
+		}
+	}
+
+	os.Exit(r.Exit)
+}
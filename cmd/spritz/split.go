@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rwtodd/Go.AppUtil/password"
+	"github.com/rwtodd/Go.Spritz/spritz"
+	"github.com/rwtodd/Go.Spritz/spritz/shamir"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var numShares int // how many shares to split the key into
+var threshold int // how many shares it takes to recover the key
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// the Type armor header of a key share
+const shareType = "spritz key share"
+
+// keyShare is one share of a file's key, as read back from its armor.
+type keyShare struct {
+	data      []byte // the share, from shamir.Split
+	keyID     string // the spritz.KeyID of the whole key
+	threshold int    // how many shares it takes
+}
+
+// readFileKey gets the real key of an encrypted file.
+func readFileKey(fname, pw string) ([]byte, error) {
+	var key []byte
+	_, err := withPassword(defaultSlot, "Password: ", pw, func(pw string) error {
+		inFile, err := os.Open(fname)
+		if err != nil {
+			return err
+		}
+		defer inFile.Close()
+		src, err := dearmor(inFile)
+		if err != nil {
+			return err
+		}
+		key, _, err = spritz.ReadKey(src, pw)
+		return err
+	})
+	return key, err
+}
+
+// writeShare writes one share as armor, to a new file.
+func writeShare(outName string, share []byte, headers map[string]string) error {
+	outName, err := claimOutput(outName)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.OpenFile(outName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	wtr, err := spritz.NewArmorWriter(outFile, headers)
+	if err == nil {
+		_, err = wtr.Write(share)
+	}
+	if err == nil {
+		err = wtr.Close()
+	}
+	if cerr := outFile.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		fmt.Println(outName)
+	}
+	return err
+}
+
+func splitMain() {
+	cmdSet := flag.NewFlagSet("split", flag.ExitOnError)
+	cmdSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: spritz split FILE [flags]")
+		fmt.Fprintln(os.Stderr, "  writes the shares as FILE.shareN.asc, in --odir or beside FILE")
+		cmdSet.PrintDefaults()
+	}
+	cmdSet.IntVar(&numShares, "shares", 5, "how many shares to write")
+	cmdSet.IntVar(&numShares, "n", 5, "shorthand for --shares")
+	cmdSet.IntVar(&threshold, "threshold", 3, "how many shares it takes to recover the key")
+	cmdSet.IntVar(&threshold, "k", 3, "shorthand for --threshold")
+	cmdSet.StringVar(&pw, "password", "", "the password of the file")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&keyFile, "key-file", "", "read the password from this file")
+	cmdSet.StringVar(&outdir, "odir", "", "the directory for the shares")
+	cmdSet.StringVar(&outdir, "o", "", "shorthand for --odir")
+	cmdSet.BoolVar(&force, "force", false, "overwrite existing shares")
+	cmdSet.BoolVar(&force, "f", false, "shorthand for --force")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) != 1 {
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+	if threshold < 2 || numShares < threshold || numShares > 255 {
+		fmt.Fprintln(os.Stderr, "Need 2 <= --threshold <= --shares <= 255.")
+		os.Exit(exitUsage)
+	}
+	fname := args[0]
+
+	var err error
+	if len(pw) == 0 {
+		if pw, err = getPassword("Password: ", 1); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	key, err := readFileKey(fname, pw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fname, checkFailure(err))
+		os.Exit(exitFailure)
+	}
+	shares, err := shamir.Split(key, numShares, threshold, spritz.NewRandom())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error splitting the key: %v\n", err)
+		os.Exit(exitFailure)
+	}
+
+	dir := outdir
+	if len(dir) == 0 {
+		dir = filepath.Dir(fname)
+	}
+	base := filepath.Base(fname)
+	for idx, share := range shares {
+		outName := filepath.Join(dir, fmt.Sprintf("%s.share%d.asc", base, idx+1))
+		err = writeShare(outName, share, map[string]string{
+			"Type":      shareType,
+			"File":      base,
+			"Key-ID":    spritz.KeyID(key),
+			"Share":     fmt.Sprintf("%d of %d", idx+1, numShares),
+			"Threshold": strconv.Itoa(threshold),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", outName, err)
+			os.Exit(exitFailure)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "any %d of the %d shares can recover %s\n", threshold, numShares, fname)
+}
+
+// readShares reads the armored shares from src, of which there may
+// be several.
+func readShares(src io.Reader) ([]keyShare, error) {
+	br := bufio.NewReader(src)
+	var shares []keyShare
+	for spritz.IsArmored(br) {
+		rdr, headers, err := spritz.NewArmorReader(br)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rdr)
+		if err != nil {
+			return nil, err
+		}
+		if headers["Type"] != shareType {
+			return nil, fmt.Errorf("not a key share")
+		}
+		share := keyShare{data: data, keyID: headers["Key-ID"]}
+		if share.threshold, err = strconv.Atoi(headers["Threshold"]); err != nil {
+			return nil, fmt.Errorf("bad threshold %q", headers["Threshold"])
+		}
+		shares = append(shares, share)
+	}
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no key shares found")
+	}
+	return shares, nil
+}
+
+// combineShares rebuilds a key from its shares, and checks it.
+func combineShares(shares []keyShare) ([]byte, error) {
+	// drop repeats, as when a share is given twice
+	seen := make(map[string]bool)
+	var data [][]byte
+	for _, share := range shares {
+		if share.keyID != shares[0].keyID {
+			return nil, fmt.Errorf("the shares are from different keys")
+		}
+		if !seen[string(share.data)] {
+			seen[string(share.data)] = true
+			data = append(data, share.data)
+		}
+	}
+	if need := shares[0].threshold; len(data) < need {
+		return nil, fmt.Errorf("need %d different shares, but have %d", need, len(data))
+	}
+
+	key, err := shamir.Combine(data)
+	if err != nil {
+		return nil, err
+	}
+	if spritz.KeyID(key) != shares[0].keyID {
+		return nil, fmt.Errorf("the shares don't rebuild their key; one may be damaged")
+	}
+	return key, nil
+}
+
+// restoreKey gives fname a new header for key, under a new password.
+// An armored file is decoded and armored again, and the new version
+// replaces the old one only once it is complete.
+func restoreKey(fname string, key []byte) error {
+	var err error
+	if len(pw) == 0 {
+		if pw, err = password.Read("New Password: ", 2); err != nil {
+			return fmt.Errorf("error reading password: %w", err)
+		}
+	}
+	if len(pw) == 0 {
+		return fmt.Errorf("missing password")
+	}
+	if err = checkStrength(pw); err != nil {
+		return err
+	}
+
+	inFile, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+	fi, err := inFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(inFile)
+	var src io.Reader = br
+	var headers map[string]string
+	armored := spritz.IsArmored(br)
+	if armored {
+		if src, headers, err = spritz.NewArmorReader(br); err != nil {
+			return err
+		}
+	}
+
+	atomic, err := createAtomic(fname)
+	if err != nil {
+		return err
+	}
+	defer atomic.Abort()
+	if err = atomic.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	var sink io.Writer = atomic.File
+	var armor io.WriteCloser
+	if armored {
+		if armor, err = spritz.NewArmorWriter(atomic.File, headers); err != nil {
+			return err
+		}
+		sink = armor
+	}
+
+	if err = spritz.RestoreHeader(sink, src, key, pw); err != nil {
+		return err
+	}
+	if armored {
+		if err = armor.Close(); err != nil {
+			return err
+		}
+	}
+	return atomic.Commit()
+}
+
+func recoverMain() {
+	cmdSet := flag.NewFlagSet("recover", flag.ExitOnError)
+	cmdSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: spritz recover FILE [SHARE-FILE...] [flags]")
+		fmt.Fprintln(os.Stderr, "  reads the shares from stdin when no share files are given")
+		cmdSet.PrintDefaults()
+	}
+	cmdSet.StringVar(&pw, "password", "", "the new password for the file")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	addStrengthFlags(cmdSet)
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) == 0 {
+		cmdSet.Usage()
+		os.Exit(exitUsage)
+	}
+	fname, sources := args[0], args[1:]
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	var shares []keyShare
+	for _, src := range sources {
+		var more []keyShare
+		var err error
+		if src == "-" {
+			more, err = readShares(os.Stdin)
+		} else if inFile, oerr := os.Open(src); oerr != nil {
+			err = oerr
+		} else {
+			more, err = readShares(inFile)
+			inFile.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", src, err)
+			os.Exit(exitFailure)
+		}
+		shares = append(shares, more...)
+	}
+
+	key, err := combineShares(shares)
+	if err == nil {
+		err = restoreKey(fname, key)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fname, err)
+		os.Exit(exitFailure)
+	}
+	fmt.Fprintf(os.Stderr, "%s: recovered, with the new password\n", fname)
+}
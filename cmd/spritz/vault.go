@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rwtodd/Go.AppUtil/password"
+	"github.com/rwtodd/Go.Spritz/spritz"
+	"github.com/rwtodd/Go.Spritz/spritz/vault"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var vaultPath string  // the vault file
+var vaultTags string  // comma-separated tags for set, or the tag to list
+var clearHistory bool // forget the change history?
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// defaultVault gives $SPRITZ_VAULT, or a vault in the home directory.
+func defaultVault() string {
+	if path := os.Getenv("SPRITZ_VAULT"); len(path) > 0 {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "vault.dat"
+	}
+	return filepath.Join(home, ".spritz", "vault.dat")
+}
+
+// openVault opens the vault, or starts a new one if create is set
+// and there isn't one yet.  The password is cached by the agent under
+// the vault's path, so the vault is unlocked once per session.
+func openVault(create bool) (*vault.Vault, error) {
+	abs, err := filepath.Abs(vaultPath)
+	if err != nil {
+		return nil, err
+	}
+	slot := "vault:" + abs
+
+	_, err = os.Stat(abs)
+	exists := err == nil
+	if !exists && !create {
+		return nil, fmt.Errorf("no vault at %s", abs)
+	}
+
+	if len(pw) == 0 {
+		times := 1
+		if !exists {
+			fmt.Fprintf(os.Stderr, "Creating a new vault at %s\n", abs)
+			times = 2
+		}
+		if pw, err = getSlotPassword(slot, "Vault password: ", times); err != nil {
+			return nil, err
+		}
+		if len(pw) == 0 {
+			return nil, fmt.Errorf("missing password")
+		}
+	}
+
+	if !exists {
+		if err = os.MkdirAll(filepath.Dir(abs), 0700); err != nil {
+			return nil, err
+		}
+		return vault.New(abs, pw), nil
+	}
+
+	var v *vault.Vault
+	_, err = withPassword(slot, "Vault password: ", pw, func(pw string) (err error) {
+		v, err = vault.Open(abs, pw)
+		return
+	})
+	if err != nil {
+		return nil, checkFailure(err)
+	}
+	return v, nil
+}
+
+// saveVault saves the vault, explaining a conflict.
+func saveVault(v *vault.Vault) error {
+	err := v.Save()
+	if err == vault.ErrChanged {
+		return fmt.Errorf("%s was changed by someone else; try again", v.Path())
+	}
+	return err
+}
+
+// splitTags turns the --tags argument into a list.
+func splitTags(arg string) []string {
+	if len(arg) == 0 {
+		return nil
+	}
+	var tags []string
+	for _, tag := range strings.Split(arg, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// readValue gets the value for set: hidden from a terminal, or all of
+// stdin, less a trailing newline.
+func readValue() (string, error) {
+	if isTerminal(os.Stdin) {
+		return password.Read("Value: ", 2)
+	}
+	data, err := ioutil.ReadAll(os.Stdin)
+	return strings.TrimSuffix(string(data), "\n"), err
+}
+
+// importDir reads a directory of encrypted files (say, from encrnote)
+// as entries, named after the files.  They must have the vault's password.
+func importDir(dir, pw string) ([]vault.Entry, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.dat"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []vault.Entry
+	for _, fname := range matches {
+		inFile, err := os.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		fi, _ := inFile.Stat()
+		var data []byte
+		rdr, _, err := spritz.WrapReader(inFile, pw)
+		if err == nil {
+			data, err = ioutil.ReadAll(rdr)
+		}
+		inFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fname, err)
+		}
+
+		e := vault.Entry{Name: strings.TrimSuffix(filepath.Base(fname), ".dat"), Value: string(data)}
+		if fi != nil {
+			e.Created = fi.ModTime()
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// importFile reads entries from a JSON file, in the format of export.
+func importFile(fname string) ([]vault.Entry, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var entries []vault.Entry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+func vaultUsage(cmdSet *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "Usage: spritz vault (get NAME|set NAME [VALUE]|rm NAME|ls|import SRC|export [FILE]|history) [flags]")
+	fmt.Fprintln(os.Stderr, "  set reads the value from stdin when it isn't given")
+	fmt.Fprintln(os.Stderr, "  import takes a JSON file from export, or a directory of .dat files")
+	cmdSet.PrintDefaults()
+	os.Exit(exitUsage)
+}
+
+func vaultMain() {
+	cmdSet := flag.NewFlagSet("vault", flag.ExitOnError)
+	cmdSet.StringVar(&vaultPath, "vault", defaultVault(), "the vault file")
+	cmdSet.StringVar(&vaultPath, "f", defaultVault(), "shorthand for --vault")
+	cmdSet.StringVar(&pw, "password", "", "the password of the vault")
+	cmdSet.StringVar(&pw, "p", "", "shorthand for --password")
+	cmdSet.StringVar(&keyFile, "key-file", "", "read the password from this file")
+	cmdSet.StringVar(&vaultTags, "tags", "", "comma-separated tags for set, or the tag to list with ls")
+	cmdSet.StringVar(&vaultTags, "t", "", "shorthand for --tags")
+	cmdSet.BoolVar(&clearHistory, "clear", false, "with history, forget the recorded changes")
+	args := parseInterspersed(cmdSet, os.Args[2:])
+
+	if len(args) == 0 {
+		vaultUsage(cmdSet)
+	}
+	op, args := args[0], args[1:]
+	nargs := map[string][2]int{ // the fewest and most arguments
+		"get": {1, 1}, "set": {1, 2}, "rm": {1, 1}, "ls": {0, 0},
+		"import": {1, 1}, "export": {0, 1}, "history": {0, 0},
+	}
+	limits, ok := nargs[op]
+	if !ok || len(args) < limits[0] || len(args) > limits[1] {
+		vaultUsage(cmdSet)
+	}
+
+	v, err := openVault(op == "set" || op == "import")
+	if err == nil {
+		err = vaultOp(v, op, args)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vault %s: %v\n", op, err)
+		os.Exit(exitFailure)
+	}
+}
+
+// vaultOp carries out one vault command.
+func vaultOp(v *vault.Vault, op string, args []string) error {
+	switch op {
+	case "get":
+		e, err := v.Get(args[0])
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		fmt.Println(e.Value)
+		return nil
+	case "set":
+		var value string
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			var err error
+			if value, err = readValue(); err != nil {
+				return err
+			}
+		}
+		v.Set(args[0], value, splitTags(vaultTags))
+		return saveVault(v)
+	case "rm":
+		if err := v.Remove(args[0]); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		return saveVault(v)
+	case "ls":
+		for _, e := range v.List(vaultTags) {
+			fmt.Printf("%s\t%s\t%s\n", e.Name, strings.Join(e.Tags, ","), e.Updated.Format(time.RFC3339))
+		}
+		return nil
+	case "import":
+		var entries []vault.Entry
+		var err error
+		if fi, serr := os.Stat(args[0]); serr == nil && fi.IsDir() {
+			entries, err = importDir(args[0], pw)
+		} else {
+			entries, err = importFile(args[0])
+		}
+		if err != nil {
+			return err
+		}
+		v.Import(entries)
+		fmt.Printf("imported %d entries\n", len(entries))
+		return saveVault(v)
+	case "export":
+		data, err := json.MarshalIndent(v.List(""), "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if len(args) == 0 {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return ioutil.WriteFile(args[0], data, 0600)
+	case "history":
+		if clearHistory {
+			v.ClearHistory()
+			return saveVault(v)
+		}
+		for _, c := range v.History() {
+			fmt.Printf("%s\t%s\t%s\n", c.Time.Format(time.RFC3339), c.Op, c.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", op)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// Command-line switches ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+var verifyMode bool   // re-read outputs to make sure they decrypt?
+var removeSource bool // delete the inputs once they verify?
+var wipeSource bool   // overwrite the inputs before deleting them?
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// verifyBits is the size of the hash used to compare plaintexts.
+const verifyBits = 256
+
+// errVerify is reported when an output doesn't decrypt to its input.
+var errVerify = errors.New("verification failed: output does not decrypt to the input")
+
+// verifyOutput decrypts the named file and checks that the hash of the
+// plaintext matches the one computed while encrypting.
+func verifyOutput(pw, fname string, want []byte) error {
+	inFile, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	src, err := dearmor(inFile)
+	if err != nil {
+		return err
+	}
+	reader, _, err := spritz.WrapReader(src, pw)
+	if err != nil {
+		return err
+	}
+
+	shash := spritz.NewHash(verifyBits)
+	if _, err = io.Copy(shash, reader); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(shash.Sum(nil), want) {
+		return errVerify
+	}
+	return nil
+}
+
+// wipeFile overwrites the contents of a file with random bytes,
+// and flushes them to disk.
+func wipeFile(fname string) error {
+	fl, err := os.OpenFile(fname, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+
+	fi, err := fl.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.CopyN(fl, rand.Reader, fi.Size()); err != nil {
+		return err
+	}
+	return fl.Sync()
+}
+
+// removeInput deletes an input file, overwriting it first if --wipe
+// was given.  N.B. on journaling or copy-on-write filesystems, and on
+// SSDs, the overwrite may not reach the original blocks.
+func removeInput(fname string) error {
+	if wipeSource {
+		if err := wipeFile(fname); err != nil {
+			return err
+		}
+	}
+	return os.Remove(fname)
+}
@@ -0,0 +1,192 @@
+package main
+
+import "strings"
+
+// wordlist is the list of 2048 words for passphrases, so each word
+// gives 11 bits of entropy.  They are common, short and easy to type.
+var wordlist = strings.Fields(`
+abbey able about above acid acorn acre act actor adapt add admiral adobe
+adult advice aerial affair afford afloat afraid after again age agenda
+agent agree ahead aid aim air airport aisle alarm album alcove alert
+algae alien alley allow almanac almond alone alpha alpine already also
+alter always amber amount ample amulet anchor ancient angel anger angle
+angry animal ankle annual answer antler anvil apart apple apricot april
+apron arcade arch archer arctic area arena argue arm armor army aroma
+arrow art artist ash aside ask aspen asset atlas atom atrium attic audio
+august aunt aurora author auto autumn avenue avocado award aware away
+awful axis baby bacon badge badger bag bagel bakery balance balcony ball
+ballad bamboo banana band banjo bank banner banquet barber bare barge
+barley barn barrel base basil basin basket bat batch bath battle bay
+beach beacon bead beam bean bear beard beast beat beaver become bed bee
+beef beehive beetle before begin behave behind being bell bellow belt
+bench bend berry best better beyond bicycle bid big bike bill bind birch
+bird birth biscuit bishop bit bitter black blade blame blank blanket
+blast blaze blend bless blimp blind blink bliss blizzard block blond
+blood bloom blossom blouse blue blunt blur blush board boat bobcat body
+boil bold bolt bond bone bonfire bonus book bookcase boost boot border
+boring borrow boss bottle bottom bounce bouquet bowl box boxer brain
+brake branch brass brave bread break breeze brick bride bridge brief
+bright bring brisk broad broken bronze brook broom brother brown brush
+bubble bucket buckle budget buffalo buffet bugle build bulb bulk bundle
+bunker burden burger burrow burst bus bush busy butter button buyer buzz
+cabbage cabin cable caboose cactus cadet cage cake calf call calm camel
+camera camp canal candle candy cannon canoe canvas canyon cape capital
+captain car caramel carbon card cardinal cargo carnival carpet carrot
+carry cart cascade case cash cashew castle casual cat catalog catch
+cattle cause cave cedar ceiling celery cell cellar cement census cereal
+chair chalet chalk change channel chapter charge chariot chart chase
+cheap check cheek cheese cheetah chef cherry chess chest chicken chief
+child chimney choice chorus chrome chunk cider cinema circle circus
+citizen citrus city civil claim clam clap clarify claw clay clean clerk
+clever click client cliff climb clinic clip clock close cloth cloud
+clover clown club clue cluster coach coast coat cobalt cobble cocoa
+coconut code coffee coil coin cold collar color column comet comfort
+comic common compass compost concert condor cone cookie copper coral
+core corn corner cottage cotton couch cougar count country couple course
+cousin cover coyote crab crack cradle craft crane crater crayon cream
+credit creek crew cricket crisp critic crocus crop cross crouch crowd
+crown cruise crumb crunch crush crystal cube cuckoo cucumber cup cupcake
+curious current curtain curve cushion custom cycle cypress dad daily
+dairy daisy damp dance danger dare dash date dawn day deal debate decade
+decide deck deer defend degree delay deliver delta demand denim dense
+dentist depart depth deputy derive desert design desk detail detour
+device devote dewdrop diagram dial diamond diary diesel diet digital
+dimple dinner dinosaur direct dish disk ditch dive doctor dog dollar
+dolphin domain donkey donor door dose double dove draft dragon drama
+drastic drawer dream dress drift drill drink drip drive drizzle drum
+duck dune during dusk dust duty dwarf dynamic eager eagle early earn
+earth easel easily east easy echo eclipse ecology edge edit educate
+effort egg eggplant eight elbow elder elect elegant element elite elm
+else embark ember emerald emerge emotion employ empty emu enable end
+energy engine enjoy enough enter entire entry episode equal equip erase
+errand escape essay estate eternal evening event exact example excess
+excite exercise exhibit exile exist exit exotic expand expect expert
+explain express extend extra eye fabric face fact faculty fade faith
+falafel falcon fall family famous fan fancy farm fashion fast father
+fault feast feather fee feel fence fern ferry festival fetch fever few
+fiber fiction fiddle field fig figure file film filter final find fine
+finger finish fire firefly firm first fiscal fish fit fitness five fix
+fjord flag flame flannel flash flat flavor fleece flight flint float
+flock floor flower fluid flute foam focus fog foil folk follow food foot
+force forest forget fork fort fortune forum forward fossil foster found
+fox fragile frame freedom fresh friend fringe frog front frost frosting
+frozen fruit fuel fun funny furnace future gadget gain galaxy gallery
+game gap garage garden garlic garment gas gate gather gauge gaze gazebo
+general genius gentle genuine gesture geyser giant gift ginger giraffe
+girl give glacier glad glance glare glass glide globe gloom glory glove
+glow glue gnome goat goblet gold golf gondola good goose gorilla gospel
+gossip govern gown grab grace grain grant grape grass gravel gravity
+gray great green grid griddle grief grill grit grocery group grow growl
+guard guess guide guitar gulf gull gym habit hair half hall hammer
+hammock hamster hand happy harbor hard harmony harvest hat hatch have
+hawk hazel head health heart heavy hedge height hello helmet help hen
+herb hero heron hickory hidden high hill hilltop hint hip hire history
+hobby hockey hold hole holiday hollow home honey hood hook hope horizon
+horn horse host hotel hour hover hub huge human humble hummus humor
+hundred hungry hunt hurdle hurry husband hybrid ice iceberg icon idea
+idle igloo ignore iguana ill image impact impose improve impulse inch
+include income index indoor infant inform inhale inject inkwell inner
+input inquiry insect inside inspire install intact invest invite iris
+iron island isolate item ivory ivy jacket jaguar jar jasmine jazz jeans
+jelly jewel job join joke journey joy judge juice july jump jungle
+junior juniper jury just kayak keen keep kernel ketchup kettle key kick
+kid kidney kiln kind kingdom kiss kit kitchen kite kitten kiwi knee
+knife knock know koala label labor ladder lady lagoon lake lamb lamp
+language lantern laptop large lasagna later latin laugh laundry lava
+lavender lawn layer lazy leader leaf learn leather lecture left leg
+legal legend lemon lend length lens leopard lesson letter lettuce level
+liberty library license lift light lilac lily limb limit linen link lion
+liquid list little live lizard lobster local lock locket lodge logic
+lonely long loop lotus loud lounge love loyal lucky luggage lullaby
+lumber lunar lunch luxury lyrics machine magic magnet magpie maid mail
+main maize major make mammal mandolin mango mansion manual maple marble
+march margin marine market marsh mask mass master match math matrix
+matter maximum meadow meal measure meat medal media melody melon member
+memory mention menu mercy merge merit merry mesh message metal meteor
+method middle milk million mimic mind minimum minor minute miracle
+mirror miss mistake mitten mix mixed mixture mobile model modify moment
+monitor monkey monsoon monster month moon moose moral morning mosaic
+mosquito mother motion motor mountain mouse move movie much muffin mule
+multiply muscle museum music mustang mustard mutual myself mystery myth
+naive name napkin narrow nation nature near neck nectar needle neglect
+neither nephew nerve nest net network neutral never news next nice night
+noble noise nominee noodle normal north nose notable note nothing notice
+novel now nuclear nugget number nurse nut nutmeg oak oasis oat oatmeal
+object oblige obscure observe obtain ocean october octopus odor off
+offer office often oil okay olive olympic omit once onion online only
+open opera opinion oppose option orange orbit orchard orchid order organ
+orient origami original orphan ostrich other otter outdoor outer output
+outside oval oven over own owner oxygen oyster ozone pace pact paddle
+page pair palace palm pancake panda panel panic panther paper paprika
+parade parent park parrot parsley party pass patch path patient patrol
+pattern pause pave payment peace peacock peanut pear peasant pebble
+pelican pen penalty pencil penguin people pepper perfect permit person
+pet pewter phone photo phrase piano picnic picture piece pig pigeon pill
+pilot pink pioneer pipe pitch pizza place planet plastic plate play
+plaza please pledge pluck plug plunge poem poet point polar pole police
+pond pony pool popular porch portion post potato pottery poverty powder
+power practice praise predict prefer prepare present pretty pretzel
+prevent price pride primary print private prize problem process produce
+profit program project promote proof prosper protect proud provide
+public pudding puffin pull pulp pulse pumpkin punch pupil puppy purchase
+purity purpose purse push puzzle pyramid quality quantum quarter quartz
+question quick quiet quilt quit quiver quiz quote rabbit raccoon race
+rack radar radio radish rail rain rainbow raise raisin rally ramp ranch
+random range rapid rare rate rather rattle raven raw razor ready real
+reason rebel rebuild recall receive recipe record recycle reduce redwood
+reflect reform refuse region regret regular reject relax release relief
+rely remain remind remove render renew rent reopen repair repeat replace
+report require rescue resist result retire retreat return reunion reveal
+review reward rhythm rib ribbon rice rich ride ridge right rigid ring
+ripple risk ritual rival river riverbed road roast robot robust rocket
+romance roof rookie room rose rotate rough round route royal rubber rude
+rug rule run runway rural sad saddle sadness safe saffron sail salad
+salmon salon salt salute same sample sand satisfy sauce sausage save say
+scale scan scare scarf scatter scene scheme school science scorpion
+scout scrap screen script scrub sea search season seat second secret
+section seed seek segment select sell seminar senior sense sequoia
+series service session settle setup seven shadow shaft shallow share
+shed shell sherbet sheriff shield shift shine ship shiver shock shoe
+shoot shop short shoulder shove shrimp shrug shuffle shy sibling sick
+side siege sight sign silent silk silly silver similar simple since sing
+siren sister situate six size skate sketch ski skill skin skirt skull
+skyline slab slam sleep slender slice slide slight slim slogan slot slow
+slush small smart smile smoke smooth snack snake snap sniff snow soap
+soccer social sock soda soft solar soldier solid solve someone song soon
+sorry sort soul sound soup source south space spare sparrow spatial
+spawn speak special speed spell spend sphere spice spider spike spin
+spinach spirit split spoil sponsor spoon sport spot spray spread spring
+sprout spy square squeeze stable stadium staff stage stairs stamp stand
+start state stay steak steel stem step stereo stick still sting stock
+stomach stone stool story stove street strike strong strudel student
+stuff stumble style subject submit subway success such sudden suffer
+sugar suggest suit summer sun sundial sunny sunset super supply supreme
+sure surface surge survey suspect sustain swallow swamp swan swap swarm
+swear sweet swift swim swing switch sword symbol symptom syrup system
+table tackle tadpole tag tail talent talk tank tape target task taste
+tattoo taxi teach team teapot tell ten tenant tennis tent term test text
+thank that theme then theory there they thimble thing this thistle
+thought three thrive throw thumb thunder ticket tide tiger tilt timber
+time tiny tip tired tissue title toast today toddler toe token tomato
+tone tongue tonight tool tooth top topic topple torch tornado toss total
+toucan tourist toward tower town toy track trade traffic tragic train
+trap trash travel tray treat tree trellis trend trial tribe trick
+trigger trim trip trophy trouble truck true truly trumpet trust truth
+try tube tuition tulip tumble tuna tunnel turkey turn turnip turtle
+tuxedo twelve twenty twice twin twist two type typical ugly unable
+unaware uncle uncover under undo unfair unfold unhappy uniform unique
+unit universe unknown unlock until unusual unveil update upgrade uphold
+upon upper upset urban urge usage use used useful useless usual utility
+vacant vacuum vague valid valley valve van vanish vapor various vast
+vault vehicle velvet vendor venture venue verb verify version very
+vessel veteran viable vibrant victory video view village vintage violin
+virtual virus visa visit visual vital vivid vocal voice void volcano
+volume vote voyage waffle wage wagon wait walk wall walnut walrus want
+warm warrior wash wasp waste water wave way wealth wear weasel weather
+web wedding weekend weird welcome west wet whale what wheat wheel when
+where whip whisper wide width wife wild will willow win window wine wing
+wink winner winter wire wisdom wise wish witness wolf woman wombat
+wonder wood wool word work world worry worth wrap wreck wrestle wrist
+write wrong yard year yellow yogurt you young youth zebra zero zone zoo
+zucchini
+`)
@@ -0,0 +1,118 @@
+package spritz
+
+// ---------------------------------------
+// authenticated encryption of short
+// messages, as in the spritz paper
+// ---------------------------------------
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// sizes for the AEAD
+const (
+	aeadNonceSize = 16
+	aeadTagSize   = 32
+	aeadBlock     = 64 // bytes encrypted between absorbing the ciphertext
+)
+
+// ErrAuthFailed is returned when a sealed message was damaged, or
+// sealed with a different key, nonce or additional data.
+var ErrAuthFailed = errors.New("message authentication failed")
+
+// spritzAEAD implements cipher.AEAD with the spritz sponge: the key,
+// nonce and additional data are absorbed, the message is encrypted a
+// block at a time with each block of ciphertext absorbed in turn, and
+// the tag is dripped out at the end.
+type spritzAEAD struct {
+	key []byte
+}
+
+// NewAEAD gives a cipher.AEAD with the given key, for sealing short
+// messages one at a time.  It takes 16-byte nonces, which must never
+// repeat under the same key, and adds a 32-byte tag.
+func NewAEAD(key []byte) cipher.AEAD {
+	return &spritzAEAD{key: append([]byte(nil), key...)}
+}
+
+func (a *spritzAEAD) NonceSize() int { return aeadNonceSize }
+func (a *spritzAEAD) Overhead() int  { return aeadTagSize }
+
+// start sets up the state for a message.
+func (a *spritzAEAD) start(nonce, ad []byte) *state {
+	if len(nonce) != aeadNonceSize {
+		panic("spritz: bad nonce size for AEAD")
+	}
+	s := new(state)
+	initialize(s)
+	absorbMany(s, a.key)
+	absorbStop(s)
+	absorbMany(s, nonce)
+	absorbStop(s)
+	absorbMany(s, ad)
+	absorbStop(s)
+	return s
+}
+
+// tag finishes the state, giving the tag.
+func (a *spritzAEAD) tag(s *state) []byte {
+	absorbStop(s)
+	absorb(s, aeadTagSize)
+	tag := make([]byte, aeadTagSize)
+	dripMany(s, tag)
+	return tag
+}
+
+// grow extends dst by n bytes, giving the whole and the new part.
+func grow(dst []byte, n int) (whole, tail []byte) {
+	if total := len(dst) + n; cap(dst) >= total {
+		whole = dst[:total]
+	} else {
+		whole = make([]byte, total)
+		copy(whole, dst)
+	}
+	return whole, whole[len(dst):]
+}
+
+func (a *spritzAEAD) Seal(dst, nonce, plaintext, ad []byte) []byte {
+	s := a.start(nonce, ad)
+	ret, out := grow(dst, len(plaintext)+aeadTagSize)
+	for idx := 0; idx < len(plaintext); idx += aeadBlock {
+		end := idx + aeadBlock
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		s.XORKeyStream(out[idx:end], plaintext[idx:end])
+		absorbMany(s, out[idx:end])
+	}
+	copy(out[len(plaintext):], a.tag(s))
+	return ret
+}
+
+func (a *spritzAEAD) Open(dst, nonce, ciphertext, ad []byte) ([]byte, error) {
+	if len(ciphertext) < aeadTagSize {
+		return nil, ErrAuthFailed
+	}
+	s := a.start(nonce, ad)
+	body, want := ciphertext[:len(ciphertext)-aeadTagSize], ciphertext[len(ciphertext)-aeadTagSize:]
+
+	// decrypt to a scratch buffer, handed over only if the tag checks out
+	plain := make([]byte, len(body))
+	for idx := 0; idx < len(body); idx += aeadBlock {
+		end := idx + aeadBlock
+		if end > len(body) {
+			end = len(body)
+		}
+		s.XORKeyStream(plain[idx:end], body[idx:end])
+		absorbMany(s, body[idx:end])
+	}
+	if subtle.ConstantTimeCompare(a.tag(s), want) != 1 {
+		return nil, ErrAuthFailed
+	}
+
+	ret, out := grow(dst, len(plain))
+	copy(out, plain)
+	return ret, nil
+}
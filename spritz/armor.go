@@ -0,0 +1,279 @@
+package spritz
+
+// ---------------------------------------
+// ASCII armor, for pasting encrypted
+// data into email, tickets and the like
+// ---------------------------------------
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	armorBegin = "-----BEGIN SPRITZ ENCRYPTED-----"
+	armorEnd   = "-----END SPRITZ ENCRYPTED-----"
+
+	armorLine    = 48   // bytes of data per line, which is 64 characters of base64
+	armorSumBits = 32   // size of the checksum
+	armorMaxSkip = 4096 // the BEGIN line must end within this many bytes, the size of a default bufio.Reader
+)
+
+// ErrBadArmor is returned when armored data is malformed.
+var ErrBadArmor = errors.New("malformed armor")
+
+// ErrArmorChecksum is returned when armored data doesn't match its checksum.
+var ErrArmorChecksum = errors.New("armor checksum mismatch")
+
+// armorWriter base64-encodes data in lines, between the BEGIN and END lines.
+type armorWriter struct {
+	w   io.Writer
+	buf []byte    // data waiting to fill a line
+	sum hash.Hash // checksum of the data
+	err error
+}
+
+// NewArmorWriter writes data as ASCII armor to w, starting with the
+// given headers (which may be nil).  The writer must be closed to
+// write the checksum and END line; it does not close w.
+func NewArmorWriter(w io.Writer, headers map[string]string) (io.WriteCloser, error) {
+	keys := make([]string, 0, len(headers))
+	for k, v := range headers {
+		if len(k) == 0 || strings.ContainsAny(k, ":\r\n") || strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("bad armor header %q: %w", k, ErrBadArmor)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var hdr bytes.Buffer
+	hdr.WriteString(armorBegin + "\n")
+	for _, k := range keys {
+		fmt.Fprintf(&hdr, "%s: %s\n", k, headers[k])
+	}
+	if len(keys) > 0 {
+		hdr.WriteString("\n")
+	}
+	if _, err := w.Write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return &armorWriter{w: w, buf: make([]byte, 0, armorLine), sum: NewHash(armorSumBits)}, nil
+}
+
+func (aw *armorWriter) writeLine(p []byte) {
+	if aw.err != nil {
+		return
+	}
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(p))+1)
+	base64.StdEncoding.Encode(line, p)
+	line[len(line)-1] = '\n'
+	_, aw.err = aw.w.Write(line)
+}
+
+func (aw *armorWriter) Write(p []byte) (int, error) {
+	if aw.err != nil {
+		return 0, aw.err
+	}
+	aw.sum.Write(p)
+
+	total := len(p)
+	for len(p) > 0 {
+		amt := armorLine - len(aw.buf)
+		if amt > len(p) {
+			amt = len(p)
+		}
+		aw.buf = append(aw.buf, p[:amt]...)
+		p = p[amt:]
+		if len(aw.buf) == armorLine {
+			aw.writeLine(aw.buf)
+			aw.buf = aw.buf[:0]
+		}
+	}
+	if aw.err != nil {
+		return 0, aw.err
+	}
+	return total, nil
+}
+
+// Close writes the last line of data, the checksum, and the END line.
+func (aw *armorWriter) Close() error {
+	if len(aw.buf) > 0 {
+		aw.writeLine(aw.buf)
+		aw.buf = aw.buf[:0]
+	}
+	if aw.err != nil {
+		return aw.err
+	}
+	_, aw.err = fmt.Fprintf(aw.w, "=%s\n%s\n",
+		base64.RawStdEncoding.EncodeToString(aw.sum.Sum(nil)), armorEnd)
+	return aw.err
+}
+
+// IsArmored tells if the data waiting in br has an armor BEGIN
+// line, at the start or after a few lines of other text, just as
+// NewArmorReader would find it.  br's buffer must hold 4096 bytes,
+// as the default size does.
+func IsArmored(br *bufio.Reader) bool {
+	peek, err := br.Peek(armorMaxSkip)
+	for len(peek) > 0 {
+		nl := bytes.IndexByte(peek, '\n')
+		if nl < 0 && err == nil {
+			// the line doesn't end within the limit
+			break
+		}
+		line := peek
+		if nl >= 0 {
+			line, peek = peek[:nl+1], peek[nl+1:]
+		} else {
+			peek = nil
+		}
+		if string(bytes.TrimSpace(line)) == armorBegin {
+			return true
+		}
+	}
+	return false
+}
+
+// armorReader decodes the lines of armored data, checking the
+// checksum at the end.
+type armorReader struct {
+	br  *bufio.Reader
+	buf []byte // decoded data not yet returned
+	sum hash.Hash
+	err error
+}
+
+// NewArmorReader reads ASCII armor from r, returning a reader for
+// the data and the headers.  Any text before the BEGIN line is
+// skipped, as long as the BEGIN line ends within 4096 bytes.  The
+// checksum is verified when the data is read to the end, so a reader
+// which hits ErrArmorChecksum has already returned bad data.
+func NewArmorReader(r io.Reader) (io.Reader, map[string]string, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	// find the BEGIN line
+	var line string
+	var err error
+	for skipped := 0; line != armorBegin; {
+		var raw string
+		raw, err = br.ReadString('\n')
+		if err == io.EOF && len(raw) > 0 {
+			err = nil
+		}
+		if skipped += len(raw); skipped > armorMaxSkip {
+			return nil, nil, fmt.Errorf("no BEGIN line: %w", ErrBadArmor)
+		}
+		if err != nil {
+			return nil, nil, armorEOF(err)
+		}
+		line = strings.TrimSpace(raw)
+	}
+
+	// a header is a "Key: Value" line, and the headers end
+	// at a blank line.  Base64 never includes a colon, so if
+	// the first line doesn't have one there are no headers.
+	headers := make(map[string]string)
+	for {
+		peek, _ := br.Peek(armorLine * 2)
+		nl := bytes.IndexByte(peek, '\n')
+		if nl < 0 {
+			nl = len(peek)
+		}
+		if len(headers) == 0 && bytes.IndexByte(peek[:nl], ':') < 0 {
+			break
+		}
+		if line, err = readLine(br); err != nil {
+			return nil, nil, armorEOF(err)
+		}
+		if len(line) == 0 {
+			break
+		}
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			return nil, nil, fmt.Errorf("bad header line %q: %w", line, ErrBadArmor)
+		}
+		headers[line[:idx]] = strings.TrimSpace(line[idx+1:])
+	}
+
+	return &armorReader{br: br, sum: NewHash(armorSumBits)}, headers, nil
+}
+
+// readLine reads a line, without its line ending or surrounding space.
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	return strings.TrimSpace(line), err
+}
+
+// armorEOF reports a premature end of the armor.
+func armorEOF(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("unexpected end of data: %w", ErrBadArmor)
+	}
+	return err
+}
+
+func (ar *armorReader) Read(p []byte) (int, error) {
+	for len(ar.buf) == 0 {
+		if ar.err != nil {
+			return 0, ar.err
+		}
+		ar.nextLine()
+	}
+
+	n := copy(p, ar.buf)
+	ar.buf = ar.buf[n:]
+	return n, nil
+}
+
+// nextLine decodes the next line into buf, or sets err at the end.
+func (ar *armorReader) nextLine() {
+	line, err := readLine(ar.br)
+	if err != nil {
+		ar.err = armorEOF(err)
+		return
+	}
+
+	switch {
+	case len(line) == 0:
+		// ignore blank lines, which mail programs like to add
+	case line[0] == '=':
+		want, err := base64.RawStdEncoding.DecodeString(line[1:])
+		if err != nil {
+			ar.err = fmt.Errorf("bad checksum line: %w", ErrBadArmor)
+			return
+		}
+		if end, err := readLine(ar.br); err != nil || end != armorEnd {
+			ar.err = fmt.Errorf("no END line: %w", ErrBadArmor)
+			return
+		}
+		if !bytes.Equal(want, ar.sum.Sum(nil)) {
+			ar.err = ErrArmorChecksum
+			return
+		}
+		ar.err = io.EOF
+	case line == armorEnd:
+		ar.err = fmt.Errorf("missing checksum: %w", ErrBadArmor)
+	default:
+		data, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			ar.err = fmt.Errorf("bad base64 line: %w", ErrBadArmor)
+			return
+		}
+		ar.sum.Write(data)
+		ar.buf = data
+	}
+}
@@ -0,0 +1,56 @@
+package spritz
+
+// ---------------------------------------
+// encryption and decryption which stop
+// when a context is cancelled
+// ---------------------------------------
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader fails its reads once the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// CopyContext is like io.Copy, but gives up with ctx.Err() once
+// the context is cancelled.  The context is checked between reads,
+// so a read that blocks forever will not be interrupted.
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return io.Copy(dst, &contextReader{ctx, src})
+}
+
+// EncryptContext encrypts all of src into dst, in the format of
+// WrapWriterVersion with the given header version, stopping early if
+// the context is cancelled.  It returns the number of plaintext bytes
+// encrypted.
+func EncryptContext(ctx context.Context, dst io.Writer, src io.Reader, pw string, origfn string, version int) (int64, error) {
+	writer, err := WrapWriterVersion(dst, pw, origfn, version)
+	if err != nil {
+		return 0, err
+	}
+	return CopyContext(ctx, writer, src)
+}
+
+// DecryptContext decrypts all of src into dst, in the format
+// of WrapReader, stopping early if the context is cancelled.
+// It returns the stored original filename, and the number of
+// plaintext bytes decrypted.
+func DecryptContext(ctx context.Context, dst io.Writer, src io.Reader, pw string) (string, int64, error) {
+	reader, fn, err := WrapReader(src, pw)
+	if err != nil {
+		return fn, 0, err
+	}
+	n, err := CopyContext(ctx, dst, reader)
+	return fn, n, err
+}
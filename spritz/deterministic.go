@@ -0,0 +1,78 @@
+package spritz
+
+// ---------------------------------------
+// deterministic encryption, for storing
+// files in version control
+// ---------------------------------------
+
+import (
+	"bytes"
+	"io"
+)
+
+// dripReader reads the output of a spritz state.
+type dripReader struct {
+	s *state
+}
+
+func (dr dripReader) Read(p []byte) (int, error) {
+	dripMany(dr.s, p)
+	return len(p), nil
+}
+
+// HasHeader tells if data starts with the magic number of a version
+// 2 or 3 header.  (Version 1 streams have no magic number, and look
+// like random bytes.)
+func HasHeader(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magicV2)) || bytes.HasPrefix(data, []byte(magicV3))
+}
+
+// EncryptDeterministic encrypts data into a version 2 stream, like
+// WrapWriterVersion, except that the salt and the real key are derived
+// from the password, the context (say, the path of the file) and the data,
+// rather than chosen at random.  So, the same inputs always give the same
+// output, which lets version control see that a file is unchanged.  This
+// reveals when two plaintexts with the same password and context are
+// equal.  The password is stretched first, as for any header, so the salt
+// in the clear makes guessing it no cheaper than for other streams.
+// WrapReader reads the result as usual.
+func EncryptDeterministic(sink io.Writer, pw, context, origfn string, data []byte) error {
+	rnd := dripReader{deterministicSeed(deterministicKey(pw, context), context, origfn, data)}
+
+	realKey := make([]byte, 64)
+	rnd.Read(realKey)
+	if err := writeHeaderV2(sink, pw, realKey, magicV2, rnd); err != nil {
+		return err
+	}
+
+	writer, err := wrapWriter(sink, realKey, origfn)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// deterministicKey stretches the password as a header does, with a
+// salt fixed by the context, since there is no random one to use.
+func deterministicKey(pw, context string) []byte {
+	salt := Sum(saltSize*8, append([]byte("spritz deterministic salt"), context...))
+	return keygen(pw, salt, 20000)
+}
+
+// deterministicSeed gives the state that the salt and the real key of
+// a deterministic stream are dripped from.
+func deterministicSeed(key []byte, context, origfn string, data []byte) *state {
+	seed := new(state)
+	initialize(seed)
+	absorbMany(seed, []byte("spritz deterministic"))
+	absorbStop(seed)
+	absorbMany(seed, key)
+	absorbStop(seed)
+	absorbMany(seed, []byte(context))
+	absorbStop(seed)
+	absorbMany(seed, []byte(origfn))
+	absorbStop(seed)
+	absorbMany(seed, data)
+	return seed
+}
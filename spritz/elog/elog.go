@@ -0,0 +1,252 @@
+// Package elog writes encrypted, append-only logs, such as audit logs.
+//
+// A log is a series of segment files in one directory, named
+// NAME-00000001.elog and so on.  Each segment starts with a spritz
+// header protecting a random key, followed by records, each sealed on
+// its own (see spritz.NewAEAD), so a record can be appended at any
+// time, including after the writer restarts, without rewriting what
+// came before.  The segments started by one Writer share its key and
+// header, so only Open, and Read once per session, pay for the
+// password check.
+//
+// Every record carries a sequence number, and is authenticated along
+// with the tag of the record before it, so records can't be dropped,
+// reordered or moved between segments without Read noticing.  The
+// first record of each segment names the segment and the last record
+// of the one before, and the last record of a full segment marks it
+// as complete.  What can't be detected is the loss of the newest
+// records of the last segment, or of whole segments at the start of
+// the log (as when old segments are deleted); Report.First and
+// Report.Last say where the log starts and ends, to compare with
+// what's expected.
+package elog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// ErrCorrupt is returned when a record fails authentication, or
+// doesn't make sense where it is.
+var ErrCorrupt = errors.New("corrupt log record")
+
+// ErrTruncated is returned when records or segments are missing.
+var ErrTruncated = errors.New("log records missing")
+
+// ErrReordered is returned when records or segments are out of order.
+var ErrReordered = errors.New("log records out of order")
+
+// errTorn is given by segmentReader.next when the file ends partway
+// through a record, as when a writer crashes mid-write.
+var errTorn = fmt.Errorf("half-written record at the end: %w", ErrTruncated)
+
+// the kinds of record
+const (
+	kindData   byte = iota // written by Write
+	kindStart              // first in each segment: its number, and the tag of the last record before it
+	kindResume             // written when a writer resumes a segment: the bytes of torn record it dropped
+	kindEnd                // last in a segment which is complete
+)
+
+const (
+	segmentExt = ".elog"
+	headerSize = 4 + 16 + 32 + spritz.KeySize + 32 // a version 2 spritz header
+	nonceSize  = 16
+	tagSize    = 32
+	lenSize    = 4           // the length before each record
+	plainExtra = 1 + 8       // the kind and time, before the data
+	maxRecord  = 1 << 24     // the most data in a record
+	startSize  = 8 + tagSize // the data of a start record
+)
+
+// segmentName gives the file name of a segment.
+func segmentName(dir, name string, segment uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%08d%s", name, segment, segmentExt))
+}
+
+// segments lists the numbers of the segments of a log, in order.
+func segments(dir, name string) ([]uint64, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, name+"-*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	var nums []uint64
+	for _, match := range matches {
+		num := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), name+"-"), segmentExt)
+		if n, err := strconv.ParseUint(num, 10, 64); err == nil && n > 0 {
+			nums = append(nums, n)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	return nums, nil
+}
+
+// record is a record as read back.
+type record struct {
+	kind byte
+	seq  uint64
+	time time.Time
+	data []byte
+}
+
+// sealRecord frames a record: its length, its nonce (which ends with
+// the sequence number), and the sealed kind, time and data.  It gives
+// the frame and the record's tag.
+func sealRecord(aead cipher.AEAD, base []byte, r record, prevTag []byte) (frame, tag []byte) {
+	plain := make([]byte, plainExtra, plainExtra+len(r.data))
+	plain[0] = r.kind
+	binary.BigEndian.PutUint64(plain[1:], uint64(r.time.UnixNano()))
+	plain = append(plain, r.data...)
+
+	frame = make([]byte, lenSize+nonceSize, lenSize+nonceSize+len(plain)+tagSize)
+	nonce := frame[lenSize:]
+	copy(nonce, base)
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], r.seq)
+	frame = aead.Seal(frame, nonce, plain, prevTag)
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-lenSize))
+	return frame, frame[len(frame)-tagSize:]
+}
+
+// segmentReader reads the records of a segment in order, checking
+// the sequence numbers and the chain of tags.
+type segmentReader struct {
+	f      *os.File
+	br     *bufio.Reader
+	header []byte // the spritz header
+	aead   cipher.AEAD
+	offset int64  // the end of the last good record
+	seq    uint64 // the sequence number expected next
+	tag    []byte // the tag of the last record, or nil at the start
+	start  record // the first record
+	ended  bool   // was the end record seen?
+}
+
+// openSegment reads the header of a segment file, and its first
+// record.  The keys of headers already seen are taken from keys, and
+// new ones added to it.
+func openSegment(fname, pw string, keys map[string][]byte) (*segmentReader, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(f, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	key, ok := keys[string(header)]
+	if err == nil && !ok {
+		if key, _, err = spritz.ReadKey(bytes.NewReader(header), pw); err == nil {
+			keys[string(header)] = key
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	sr := &segmentReader{f: f, br: bufio.NewReader(f), header: header,
+		aead: spritz.NewAEAD(key), offset: headerSize}
+	if sr.start, err = sr.next(); err == io.EOF {
+		err = ErrTruncated
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return sr, nil
+}
+
+// readFrame reads the next record's frame, without its length,
+// giving its sequence number.  It gives io.EOF at the end of the file,
+// and errTorn when the file ends partway through a record.
+func (sr *segmentReader) readFrame() (uint64, []byte, error) {
+	lenBuf := make([]byte, lenSize)
+	if _, err := io.ReadFull(sr.br, lenBuf); err == io.ErrUnexpectedEOF {
+		return 0, nil, errTorn
+	} else if err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(lenBuf)
+	if size < nonceSize+plainExtra+tagSize || size > nonceSize+plainExtra+maxRecord+tagSize {
+		return 0, nil, ErrCorrupt
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(sr.br, frame); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, nil, errTorn
+	} else if err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint64(frame[nonceSize-8 : nonceSize]), frame, nil
+}
+
+// comesLater looks through the rest of the segment for a record
+// numbered from seq up to, but not including, before, which tells
+// records moved out of order from records which are missing.
+func (sr *segmentReader) comesLater(seq, before uint64) bool {
+	for {
+		s, _, err := sr.readFrame()
+		if err != nil {
+			return false
+		}
+		if s >= seq && s < before {
+			return true
+		}
+	}
+}
+
+// next reads the next record.  It gives io.EOF at the end of the file,
+// and errTorn when the file ends partway through a record.
+func (sr *segmentReader) next() (record, error) {
+	var r record
+	seq, frame, err := sr.readFrame()
+	if err != nil {
+		return r, err
+	}
+
+	nonce, sealed := frame[:nonceSize], frame[nonceSize:]
+	r.seq = seq
+	if sr.tag != nil {
+		switch {
+		case r.seq < sr.seq:
+			return r, ErrReordered
+		case r.seq > sr.seq && sr.comesLater(sr.seq, r.seq):
+			return r, ErrReordered
+		case r.seq > sr.seq:
+			return r, ErrTruncated
+		}
+	}
+	plain, err := sr.aead.Open(nil, nonce, sealed, sr.tag)
+	if err != nil {
+		return r, ErrCorrupt
+	}
+	r.kind, r.data = plain[0], plain[plainExtra:]
+	r.time = time.Unix(0, int64(binary.BigEndian.Uint64(plain[1:])))
+
+	// the start must come first, and nothing after the end
+	if (r.kind == kindStart) != (sr.tag == nil) || sr.ended || r.kind > kindEnd ||
+		(r.kind == kindStart && len(r.data) != startSize) {
+		return r, ErrCorrupt
+	}
+	sr.ended = r.kind == kindEnd
+	sr.offset += int64(lenSize + len(frame))
+	sr.seq = r.seq + 1
+	sr.tag = sealed[len(sealed)-tagSize:]
+	return r, nil
+}
+
+func (sr *segmentReader) Close() error {
+	return sr.f.Close()
+}
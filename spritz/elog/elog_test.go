@@ -0,0 +1,203 @@
+package elog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// writeLog writes count records to a log in a temporary directory,
+// in two sessions, with small segments.
+func writeLog(t *testing.T, count int) string {
+	dir, err := ioutil.TempDir("", "elog-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for session := 0; session < 2; session++ {
+		w, err := Open(dir, "audit", "pw", Options{MaxSize: 600})
+		if err != nil {
+			t.Fatalf("Error opening writer: %v", err)
+		}
+		for idx := session * count / 2; idx < (session+1)*count/2; idx++ {
+			if _, err = fmt.Fprintf(w, "record %d\n", idx); err != nil {
+				t.Fatalf("Error writing: %v", err)
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Error closing: %v", err)
+		}
+	}
+	return dir
+}
+
+// readAll reads the data of every record.
+func readAll(dir string) ([]string, Report, error) {
+	var got []string
+	rep, err := Read(dir, "audit", "pw", func(r Record) error {
+		got = append(got, string(r.Data))
+		return nil
+	})
+	return got, rep, err
+}
+
+// frames splits a segment file into its header and records.
+func frames(t *testing.T, fname string) ([]byte, [][]byte) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, data := data[:headerSize], data[headerSize:]
+	var recs [][]byte
+	for len(data) > 0 {
+		size := lenSize + int(binary.BigEndian.Uint32(data))
+		recs = append(recs, data[:size])
+		data = data[size:]
+	}
+	return hdr, recs
+}
+
+func writeFrames(t *testing.T, fname string, hdr []byte, recs [][]byte) {
+	if err := ioutil.WriteFile(fname, append(hdr, bytes.Join(recs, nil)...), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	dir := writeLog(t, 40)
+	defer os.RemoveAll(dir)
+
+	got, rep, err := readAll(dir)
+	if err != nil {
+		t.Fatalf("Error reading: %v", err)
+	}
+	if len(got) != 40 || rep.Records != 40 {
+		t.Fatalf("Read %d records, reported %d, instead of 40", len(got), rep.Records)
+	}
+	for idx, rec := range got {
+		if rec != fmt.Sprintf("record %d\n", idx) {
+			t.Fatalf("Record %d was %q", idx, rec)
+		}
+	}
+	if rep.Segments < 3 || rep.Restarts != 1 || rep.First != 0 || rep.Complete {
+		t.Fatalf("Unexpected report %+v", rep)
+	}
+
+	if _, err = Read(dir, "audit", "wrong", nil); err == nil {
+		t.Fatalf("Wrong password was accepted")
+	}
+}
+
+// TestTorn checks that a writer resumes after a half-written record.
+func TestTorn(t *testing.T) {
+	dir := writeLog(t, 10)
+	defer os.RemoveAll(dir)
+
+	nums, _ := segments(dir, "audit")
+	last := segmentName(dir, "audit", nums[len(nums)-1])
+	hdr, recs := frames(t, last)
+	torn := recs[len(recs)-1]
+	writeFrames(t, last, hdr, append(recs[:len(recs)-1], torn[:len(torn)-5]))
+
+	if _, err := Read(dir, "audit", "pw", nil); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Torn record gave <%v>", err)
+	}
+
+	w, err := Open(dir, "audit", "pw", Options{})
+	if err != nil {
+		t.Fatalf("Error resuming: %v", err)
+	}
+	w.Write([]byte("after"))
+	w.Close()
+
+	got, rep, err := readAll(dir)
+	if err != nil || rep.Dropped != int64(len(torn)-5) || got[len(got)-1] != "after" || len(got) != 10 {
+		t.Fatalf("After resuming, read %d records <%v>, report %+v", len(got), err, rep)
+	}
+}
+
+// TestUnstarted checks that a writer starts again on a segment which
+// a crash left without its header or start record.
+func TestUnstarted(t *testing.T) {
+	for _, keep := range []int64{0, headerSize / 2, headerSize + 10} {
+		dir := writeLog(t, 10)
+		w, err := Open(dir, "audit", "pw", Options{})
+		if err != nil {
+			t.Fatalf("Error opening writer: %v", err)
+		}
+		w.Rotate()
+		w.Close()
+		nums, _ := segments(dir, "audit")
+		os.Truncate(segmentName(dir, "audit", nums[len(nums)-1]), keep)
+
+		if w, err = Open(dir, "audit", "pw", Options{}); err != nil {
+			t.Fatalf("Keeping %d bytes, error reopening: %v", keep, err)
+		}
+		w.Write([]byte("after"))
+		w.Close()
+
+		got, _, err := readAll(dir)
+		if err != nil || len(got) != 11 || got[10] != "after" {
+			t.Fatalf("Keeping %d bytes, read %d records <%v>", keep, len(got), err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+// TestTamper checks that changes to the log are caught.
+func TestTamper(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		want   error
+	}{
+		{"drop a record", func(t *testing.T, dir string) {
+			fname := segmentName(dir, "audit", 1)
+			hdr, recs := frames(t, fname)
+			writeFrames(t, fname, hdr, append(recs[:2], recs[3:]...))
+		}, ErrTruncated},
+		{"swap records", func(t *testing.T, dir string) {
+			fname := segmentName(dir, "audit", 1)
+			hdr, recs := frames(t, fname)
+			recs[2], recs[3] = recs[3], recs[2]
+			writeFrames(t, fname, hdr, recs)
+		}, ErrReordered},
+		{"repeat a record", func(t *testing.T, dir string) {
+			fname := segmentName(dir, "audit", 1)
+			hdr, recs := frames(t, fname)
+			writeFrames(t, fname, hdr, append(recs[:3], recs[2:]...))
+		}, ErrReordered},
+		{"cut a full segment", func(t *testing.T, dir string) {
+			fname := segmentName(dir, "audit", 1)
+			hdr, recs := frames(t, fname)
+			writeFrames(t, fname, hdr, recs[:len(recs)-2])
+		}, ErrTruncated},
+		{"drop a segment", func(t *testing.T, dir string) {
+			os.Remove(segmentName(dir, "audit", 2))
+		}, ErrTruncated},
+		{"swap segments", func(t *testing.T, dir string) {
+			one, two := segmentName(dir, "audit", 1), segmentName(dir, "audit", 2)
+			os.Rename(one, one+".tmp")
+			os.Rename(two, one)
+			os.Rename(one+".tmp", two)
+		}, ErrReordered},
+		{"change a byte", func(t *testing.T, dir string) {
+			fname := segmentName(dir, "audit", 2)
+			data, _ := ioutil.ReadFile(fname)
+			data[len(data)-40] ^= 1
+			ioutil.WriteFile(fname, data, 0600)
+		}, ErrCorrupt},
+	}
+
+	for _, test := range tests {
+		dir := writeLog(t, 40)
+		test.change(t, dir)
+		if _, err := Read(dir, "audit", "pw", nil); !errors.Is(err, test.want) {
+			t.Errorf("%s: got <%v>, want <%v>", test.name, err, test.want)
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,117 @@
+package elog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Record is a record written to the log.
+type Record struct {
+	Seq  uint64    // the sequence number, counting every record in the log
+	Time time.Time // when it was written
+	Data []byte
+}
+
+// Report describes a log read by Read.
+type Report struct {
+	Segments    int    // segment files read
+	Records     int    // records given by Write
+	First, Last uint64 // sequence numbers of the first and last records
+	Restarts    int    // times a writer resumed a segment
+	Dropped     int64  // bytes of half-written records dropped by resuming writers
+	Complete    bool   // does the last segment end with its end record?
+}
+
+// Read reads the log NAME in dir, checking it as it goes, and calls
+// fn (if it isn't nil) for each record given to Write.  It stops at
+// the first problem, or the first error from fn, returning what it
+// has read so far.  The log can be read while it is being written.
+func Read(dir, name, pw string, fn func(Record) error) (Report, error) {
+	var rep Report
+	nums, err := segments(dir, name)
+	if err != nil {
+		return rep, err
+	}
+	if len(nums) == 0 {
+		return rep, fmt.Errorf("no segments of %s in %s", name, dir)
+	}
+
+	var prevTag []byte // the tag of the last record of the previous segment
+	keys := make(map[string][]byte)
+	for idx, num := range nums {
+		if idx > 0 && num != nums[idx-1]+1 {
+			return rep, fmt.Errorf("segment %d is missing: %w", nums[idx-1]+1, ErrTruncated)
+		}
+		if err = readSegment(dir, name, pw, keys, num, &rep, &prevTag, fn); err != nil {
+			return rep, err
+		}
+		rep.Segments++
+		if !rep.Complete && idx < len(nums)-1 {
+			return rep, fmt.Errorf("segment %d has no end record: %w", num, ErrTruncated)
+		}
+	}
+	return rep, nil
+}
+
+// readSegment reads one segment into the report, checking that it
+// follows the previous segment, if there was one.
+func readSegment(dir, name, pw string, keys map[string][]byte, num uint64, rep *Report, prevTag *[]byte, fn func(Record) error) error {
+	sr, err := openSegment(segmentName(dir, name, num), pw, keys)
+	if err != nil {
+		return fmt.Errorf("segment %d: %w", num, err)
+	}
+	defer sr.Close()
+
+	// check the start record against the end of the last segment
+	start := sr.start
+	if n := binary.BigEndian.Uint64(start.data); n != num {
+		return fmt.Errorf("segment %d was written as segment %d: %w", num, n, ErrReordered)
+	}
+	if *prevTag == nil {
+		rep.First = start.seq
+	} else {
+		switch {
+		case start.seq < rep.Last+1:
+			return fmt.Errorf("segment %d starts at record %d, before %d: %w", num, start.seq, rep.Last+1, ErrReordered)
+		case start.seq > rep.Last+1:
+			return fmt.Errorf("segment %d starts at record %d, after %d: %w", num, start.seq, rep.Last+1, ErrTruncated)
+		case !bytes.Equal(start.data[8:], *prevTag):
+			return fmt.Errorf("segment %d doesn't follow segment %d: %w", num, num-1, ErrReordered)
+		}
+	}
+	rep.Last = start.seq
+
+	rep.Complete = false
+	for {
+		r, err := sr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("segment %d, after record %d: %w", num, rep.Last, err)
+		}
+		rep.Last = r.seq
+
+		switch r.kind {
+		case kindData:
+			rep.Records++
+			if fn != nil {
+				if err = fn(Record{Seq: r.seq, Time: r.time, Data: r.data}); err != nil {
+					return err
+				}
+			}
+		case kindResume:
+			rep.Restarts++
+			if len(r.data) == 8 {
+				rep.Dropped += int64(binary.BigEndian.Uint64(r.data))
+			}
+		case kindEnd:
+			rep.Complete = true
+		}
+	}
+	*prevTag = sr.tag
+	return nil
+}
@@ -0,0 +1,229 @@
+package elog
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// errClosed is given by a Writer after Close.
+var errClosed = errors.New("elog: writer is closed")
+
+// Options controls when a Writer starts a new segment, and how
+// carefully it writes.  The zero value never rotates.
+type Options struct {
+	MaxSize int64         // start a new segment once one is this big, or 0 for no limit
+	MaxAge  time.Duration // start a new segment once one is this old, or 0 for no limit
+	Sync    bool          // sync each record to disk before Write returns
+}
+
+// Writer appends records to a log.  Each Write is one record, so a
+// Writer makes a good output for a log.Logger.  It is safe for
+// concurrent use.
+type Writer struct {
+	mu   sync.Mutex
+	dir  string
+	name string
+	opts Options
+	rnd  *spritz.Random
+
+	f       *os.File
+	header  []byte // the spritz header of the segments of this session
+	aead    cipher.AEAD
+	base    []byte    // the start of every nonce in this session
+	segment uint64    // the number of the current segment
+	size    int64     // the size of the current segment
+	started time.Time // when the current segment was started
+	seq     uint64    // the sequence number of the next record
+	tag     []byte    // the tag of the last record
+	err     error     // a failure which stops further writes
+}
+
+// Open opens the log NAME in dir for appending, starting it if there
+// are no segments yet.  If the last segment isn't complete, the Writer
+// resumes it, dropping any record left half-written by a crash;
+// otherwise it starts a new segment.  A last segment which a crash left
+// without its header or start record is started again.  Each Open draws
+// fresh nonces.
+func Open(dir, name, pw string, opts Options) (*Writer, error) {
+	w := &Writer{dir: dir, name: name, opts: opts, rnd: spritz.NewRandom(), base: make([]byte, nonceSize-8)}
+	if _, err := w.rnd.Read(w.base); err != nil {
+		return nil, err
+	}
+
+	nums, err := segments(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		key := make([]byte, spritz.KeySize)
+		if _, err = w.rnd.Read(key); err != nil {
+			return nil, err
+		}
+		var header bytes.Buffer
+		if err = spritz.WriteKey(&header, pw, key, spritz.HeaderV2); err != nil {
+			return nil, err
+		}
+		w.header, w.aead = header.Bytes(), spritz.NewAEAD(key)
+		w.tag = make([]byte, tagSize)
+		return w, w.newSegment(1)
+	}
+
+	last := nums[len(nums)-1]
+	fname := segmentName(dir, name, last)
+	sr, err := openSegment(fname, pw, make(map[string][]byte))
+	if errors.Is(err, ErrTruncated) {
+		// a crash while starting the segment left it without its header
+		// or its start record, so nothing was written to it: start over
+		if err = os.Remove(fname); err != nil {
+			return nil, err
+		}
+		return Open(dir, name, pw, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("segment %d: %w", last, err)
+	}
+	defer sr.Close()
+	for err == nil {
+		_, err = sr.next()
+	}
+	if err != io.EOF && err != errTorn {
+		return nil, fmt.Errorf("segment %d: %w", last, err)
+	}
+	fi, err := sr.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	w.segment, w.seq, w.tag = last, sr.seq, sr.tag
+	w.header, w.aead = sr.header, sr.aead
+	w.started = sr.start.time
+	if sr.ended {
+		return w, w.newSegment(last + 1)
+	}
+
+	// drop a half-written record, noting its size
+	dropped := uint64(fi.Size() - sr.offset)
+	if w.f, err = os.OpenFile(fname, os.O_WRONLY, 0); err != nil {
+		return nil, err
+	}
+	if err = w.f.Truncate(sr.offset); err == nil {
+		_, err = w.f.Seek(sr.offset, io.SeekStart)
+	}
+	if err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	w.size = sr.offset
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, dropped)
+	if err = w.append(kindResume, data); err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// newSegment starts a segment, with its start record.
+func (w *Writer) newSegment(segment uint64) error {
+	f, err := os.OpenFile(segmentName(w.dir, w.name, segment), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(w.header); err != nil {
+		f.Close()
+		return err
+	}
+
+	data := make([]byte, 8, startSize)
+	binary.BigEndian.PutUint64(data, segment)
+	data = append(data, w.tag...)
+
+	w.f, w.segment, w.size = f, segment, int64(len(w.header))
+	w.started = time.Now()
+	w.tag = nil
+	return w.append(kindStart, data)
+}
+
+// append seals and writes one record.
+func (w *Writer) append(kind byte, data []byte) error {
+	r := record{kind: kind, seq: w.seq, time: time.Now(), data: data}
+	frame, tag := sealRecord(w.aead, w.base, r, w.tag)
+	if _, err := w.f.Write(frame); err != nil {
+		return err
+	}
+	if w.opts.Sync {
+		if err := w.f.Sync(); err != nil {
+			return err
+		}
+	}
+	w.size += int64(len(frame))
+	w.seq++
+	w.tag = tag
+	return nil
+}
+
+// rotate completes the current segment, and starts the next one.
+func (w *Writer) rotate() error {
+	err := w.append(kindEnd, nil)
+	if err == nil {
+		err = w.f.Close()
+	}
+	if err == nil {
+		err = w.newSegment(w.segment + 1)
+	}
+	return err
+}
+
+// Write appends p to the log as one record, first starting a new
+// segment if the current one is too big or too old.
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(p) > maxRecord {
+		return 0, fmt.Errorf("elog: record of %d bytes is too big", len(p))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	if (w.opts.MaxSize > 0 && w.size >= w.opts.MaxSize) ||
+		(w.opts.MaxAge > 0 && time.Since(w.started) >= w.opts.MaxAge) {
+		if w.err = w.rotate(); w.err != nil {
+			return 0, w.err
+		}
+	}
+	if w.err = w.append(kindData, p); w.err != nil {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+// Rotate completes the current segment, and starts a new one.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = w.rotate()
+	}
+	return w.err
+}
+
+// Close closes the log file.  The segment stays open to be resumed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == errClosed {
+		return nil
+	}
+	w.err = errClosed
+	return w.f.Close()
+}
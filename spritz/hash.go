@@ -1,6 +1,9 @@
 package spritz
 
-import "hash"
+import (
+	"errors"
+	"hash"
+)
 
 // Hash provides the hash.Hash interface, consistent with the
 // standard packages.
@@ -74,6 +77,70 @@ func (h *sphash) Size() int { return h.size }
 // returns 1.
 func (h *sphash) BlockSize() int { return 1 }
 
+// hashMagic identifies a marshaled hash state, and its version.
+const hashMagic = "spz\x01"
+
+// marshaledSize is the length of a marshaled hash state: the magic number,
+// a 4-byte hash size, the six registers, and the S-box.
+const marshaledSize = len(hashMagic) + 4 + 6 + 256
+
+// maxHashSize is the largest hash size, in bytes, UnmarshalBinary
+// accepts... far beyond any real use, but small enough that a corrupt
+// state can't make Sum allocate without bound.
+const maxHashSize = 1 << 16
+
+// MarshalBinary saves the state of the hash, so that it can be
+// resumed later by UnmarshalBinary.  It implements
+// encoding.BinaryMarshaler.
+func (h *sphash) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, marshaledSize)
+	b = append(b, hashMagic...)
+	b = append(b, byte(h.size>>24), byte(h.size>>16), byte(h.size>>8), byte(h.size))
+	st := &h.spritzState
+	b = append(b, st.i, st.j, st.k, st.z, st.a, st.w)
+	b = append(b, st.s[:]...)
+	return b, nil
+}
+
+// UnmarshalBinary restores a hash state saved by MarshalBinary,
+// including the size of the hash.  States which MarshalBinary could
+// not have written are rejected.  It implements
+// encoding.BinaryUnmarshaler.
+func (h *sphash) UnmarshalBinary(b []byte) error {
+	if len(b) < len(hashMagic) || string(b[:len(hashMagic)]) != hashMagic {
+		return errors.New("spritz: invalid hash state identifier")
+	}
+	if len(b) != marshaledSize {
+		return errors.New("spritz: invalid hash state size")
+	}
+	b = b[len(hashMagic):]
+
+	size := int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+	if size <= 0 || size > maxHashSize {
+		return errors.New("spritz: invalid hash size")
+	}
+	b = b[4:]
+
+	// w must be odd, a can't pass half the S-box, and the S-box must
+	// be a permutation
+	if b[5]&1 == 0 || b[4] > 256/2 {
+		return errors.New("spritz: invalid hash state")
+	}
+	var seen [256]bool
+	for _, v := range b[6:] {
+		if seen[v] {
+			return errors.New("spritz: invalid hash state")
+		}
+		seen[v] = true
+	}
+
+	h.size = size
+	st := &h.spritzState
+	st.i, st.j, st.k, st.z, st.a, st.w = b[0], b[1], b[2], b[3], b[4], b[5]
+	copy(st.s[:], b[6:])
+	return nil
+}
+
 // Sum returns the hash of the given data, sized to
 // the given number of bits.
 func Sum(bits int, data []byte) []byte {
@@ -0,0 +1,196 @@
+package spritz
+
+// ---------------------------------------
+// getting at the real key of a stream,
+// for escrow and recovery
+// ---------------------------------------
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeySize is the size of the real key, which encrypts the stream
+// behind its header.
+const KeySize = 64
+
+// sizes of the whole headers, which let them be rewritten in place
+const (
+	headerSizeV1 = 4 + 4 + 4 + KeySize
+	headerSizeV2 = len(magicV2) + saltSize + verifierSize + KeySize + keyCheckSize
+)
+
+// ReadKey reads the header of a stream, and gives its real key and
+// header version.  Anyone holding the key can read the stream, and
+// can give it a new password with RestoreHeader, so the key needs
+// the same care as the password.
+func ReadKey(src io.Reader, pw string) (key []byte, version int, err error) {
+	return readHeader(src, pw)
+}
+
+// WriteKey writes a header of the given version, protecting key
+// with pw.  It is the opposite of ReadKey, for formats which keep their
+// own data after a spritz header.
+func WriteKey(sink io.Writer, pw string, key []byte, version int) error {
+	if len(key) != KeySize {
+		return ErrCorruptHeader
+	}
+	return writeHeader(sink, pw, key, version)
+}
+
+// KeyID gives a short fingerprint of a real key, to check that a key
+// recovered from a backup or from shares is the one expected.  It
+// tells nothing useful about the key itself.
+func KeyID(key []byte) string {
+	h := NewHash(64)
+	h.Write([]byte("spritz key id"))
+	h.Write(key)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ErrWrongKey is returned by RestoreHeader when the key doesn't
+// decrypt the stream.
+var ErrWrongKey = errors.New("the key doesn't match the stream")
+
+// restorePeek is how much of the body RestoreHeader decrypts to
+// check the key: the filename, the options, and then some.
+const restorePeek = 1024
+
+// RestoreHeader copies the stream src to sink with a new header,
+// protecting key with newpw, for when the old password is lost but the
+// key was kept (see ReadKey).  The header keeps its version, and the
+// rest of the stream is copied as it is.  The key is checked first
+// against the start of the stream, which must give a sensible filename
+// (and, in version 3, options), so a mismatched key gives ErrWrongKey
+// instead of an unreadable stream.  The check is weaker for streams
+// without a filename, so check the key with KeyID too, when possible.
+func RestoreHeader(sink io.Writer, src io.Reader, key []byte, newpw string) error {
+	if len(key) != KeySize {
+		return ErrCorruptHeader
+	}
+	br := bufio.NewReaderSize(src, headerSizeV2+restorePeek)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return headerError(err)
+	}
+	version, size := HeaderV1, headerSizeV1
+	switch string(magic) {
+	case magicV2:
+		version, size = HeaderV2, headerSizeV2
+	case magicV3:
+		version, size = HeaderV3, headerSizeV2
+	}
+
+	start, _ := br.Peek(size + restorePeek)
+	if len(start) < size {
+		return ErrTruncatedHeader
+	}
+	if !keyFits(start[size:], key, version) {
+		return ErrWrongKey
+	}
+
+	if err = writeHeader(sink, newpw, key, version); err != nil {
+		return err
+	}
+	if _, err = br.Discard(size); err != nil {
+		return err
+	}
+	_, err = io.Copy(sink, br)
+	return err
+}
+
+// keyFits tells if key decrypts the start of a body into a filename
+// without control characters and, in version 3, known options.
+func keyFits(body, key []byte, version int) bool {
+	_, fn, _, err := unwrapBody(bytes.NewReader(body), key, version)
+	if err != nil || !utf8.ValidString(fn) {
+		return false
+	}
+	for _, r := range fn {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrBadRecoveryCode is returned by ParseRecoveryCode when the code
+// is the wrong length, or fails its checksum.
+var ErrBadRecoveryCode = errors.New("bad recovery code")
+
+// recovery codes hold a version byte, the key, and a checksum, which
+// come to a whole number of base32 groups
+const (
+	recoveryVersion = 1
+	recoverySumBits = 40
+	recoverySize    = 1 + KeySize + recoverySumBits/8
+	recoveryGroup   = 4 // characters in a group
+	recoveryPerLine = 7 // groups in a line
+	recoveryContext = "spritz recovery code"
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// the digits base32 doesn't use, as the letters they were probably meant to be
+var recoveryFixes = strings.NewReplacer("0", "O", "1", "I", "8", "B")
+
+// recoverySum gives the checksum of the version byte and key.
+func recoverySum(data []byte) []byte {
+	h := NewHash(recoverySumBits)
+	h.Write([]byte(recoveryContext))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// RecoveryCode writes a real key (see ReadKey) as text meant to be
+// printed or written down: base32 in groups of four characters, with
+// a checksum to catch mistakes in copying it back.
+func RecoveryCode(key []byte) string {
+	data := append([]byte{recoveryVersion}, key...)
+	data = append(data, recoverySum(data)...)
+	enc := recoveryEncoding.EncodeToString(data)
+
+	var code strings.Builder
+	for idx := 0; idx < len(enc); idx += recoveryGroup {
+		switch {
+		case idx == 0:
+		case idx%(recoveryGroup*recoveryPerLine) == 0:
+			code.WriteByte('\n')
+		default:
+			code.WriteByte('-')
+		}
+		code.WriteString(enc[idx : idx+recoveryGroup])
+	}
+	return code.String()
+}
+
+// ParseRecoveryCode reads a key back from a RecoveryCode.  It ignores
+// case, spaces and dashes, and takes 0, 1 and 8 (which base32 doesn't
+// use) as the O, I and B they were probably meant to be.
+func ParseRecoveryCode(code string) ([]byte, error) {
+	var clean strings.Builder
+	for _, r := range recoveryFixes.Replace(strings.ToUpper(code)) {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '2' && r <= '7':
+			clean.WriteRune(r)
+		case r == '-' || r == ' ' || r == '\t' || r == '\r' || r == '\n':
+		default:
+			return nil, ErrBadRecoveryCode
+		}
+	}
+
+	data, err := recoveryEncoding.DecodeString(clean.String())
+	if err != nil || len(data) != recoverySize || data[0] != recoveryVersion {
+		return nil, ErrBadRecoveryCode
+	}
+	if !bytes.Equal(recoverySum(data[:1+KeySize]), data[1+KeySize:]) {
+		return nil, ErrBadRecoveryCode
+	}
+	return data[1 : 1+KeySize], nil
+}
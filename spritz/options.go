@@ -0,0 +1,377 @@
+package spritz
+
+// ---------------------------------------
+// optional features of the file format,
+// recorded in version 3 streams
+// ---------------------------------------
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rwtodd/Go.AppUtil/errs"
+)
+
+// ErrUnsupported is returned for streams using options this
+// version of the package doesn't know about.
+var ErrUnsupported = errors.New("unsupported format options")
+
+// ErrTruncated is returned when a chunked stream ends before
+// its final chunk.
+var ErrTruncated = errors.New("encrypted data is truncated")
+
+// PadPolicy selects how the length of the plaintext is hidden.
+type PadPolicy int
+
+const (
+	PadNone       PadPolicy = iota // no padding
+	PadPadme                       // Padmé: at most ~12% overhead, leaking O(log log n) bits
+	PadPowerOfTwo                  // round up to a power of two
+	PadBlock                       // round up to a multiple of Padding.Block
+)
+
+// Padding describes how to pad a stream.
+type Padding struct {
+	Policy PadPolicy
+	Block  int64 // the block size, for PadBlock
+}
+
+// Size gives the padded size of a stream of n bytes.
+func (p Padding) Size(n int64) int64 {
+	switch p.Policy {
+	case PadPadme:
+		if n < 2 {
+			return n
+		}
+		e := bitLen(n) - 1 // floor(log2 n)
+		s := bitLen(int64(e))
+		mask := int64(1)<<uint(e-s) - 1
+		return (n + mask) &^ mask
+	case PadPowerOfTwo:
+		size := int64(1)
+		for size < n {
+			size <<= 1
+		}
+		return size
+	case PadBlock:
+		if p.Block <= 0 {
+			return n
+		}
+		return (n + p.Block - 1) / p.Block * p.Block
+	}
+	return n
+}
+
+// bitLen gives the number of bits needed to hold n.
+func bitLen(n int64) int {
+	var bits int
+	for ; n > 0; n >>= 1 {
+		bits++
+	}
+	return bits
+}
+
+// Compression selects how the plaintext is compressed before it
+// is encrypted.
+type Compression int
+
+const (
+	CompressNone  Compression = iota // no compression
+	CompressFlate                    // raw DEFLATE, from compress/flate
+	CompressGzip                     // gzip, which adds its own CRC-32
+)
+
+// Options selects the optional features of a stream written by
+// WrapWriterOptions.  The zero value selects none of them.
+type Options struct {
+	Pad      Padding     // hide the length of the plaintext
+	Compress Compression // compress the plaintext first
+}
+
+// StreamInfo tells how a stream was written.  Only the presence
+// of padding is recorded, not the policy which chose its size.
+type StreamInfo struct {
+	Version  int         // the header version: HeaderV1, HeaderV2 or HeaderV3
+	Padded   bool        // the length of the plaintext is hidden
+	Compress Compression // how the plaintext was compressed
+}
+
+// option flags, stored encrypted right after the filename in
+// a version 3 stream.
+const (
+	flagChunked byte = 1 << iota // data is framed in chunks, then padded
+	flagFlate                    // data is compressed with flate
+	flagGzip                     // data is compressed with gzip
+	knownFlags  = flagChunked | flagFlate | flagGzip
+)
+
+// chunkSize is the most data the writer puts in one chunk.
+const chunkSize = 64 * 1024
+
+// WrapWriterOptions is like WrapWriter, but writes a version 3
+// stream with the given options.  The returned writer must be
+// closed to finish the stream (it does not close sink).
+func WrapWriterOptions(sink io.Writer, pw string, origfn string, opts Options) (io.WriteCloser, error) {
+	var flags byte
+	if opts.Pad.Policy != PadNone {
+		flags |= flagChunked
+	}
+	switch opts.Compress {
+	case CompressNone:
+	case CompressFlate:
+		flags |= flagFlate
+	case CompressGzip:
+		flags |= flagGzip
+	default:
+		return nil, ErrUnsupported
+	}
+
+	realKey := make([]byte, 64)
+	if _, err := rand.Read(realKey); err != nil {
+		return nil, err
+	}
+	counter := &countingWriter{w: sink}
+	if err := writeHeader(counter, pw, realKey, HeaderV3); err != nil {
+		return nil, err
+	}
+	writer, err := wrapWriter(counter, realKey, origfn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write([]byte{flags}); err != nil {
+		return nil, errs.Wrap("Writing encryption header", err)
+	}
+
+	// the layers go: compression, then chunking and padding, then encryption
+	var out io.WriteCloser = nopCloser{writer}
+	if flags&flagChunked != 0 {
+		out = &padWriter{w: writer, count: counter, pad: opts.Pad}
+	}
+	switch {
+	case flags&flagFlate != 0:
+		zw, _ := flate.NewWriter(out, flate.DefaultCompression) // the level is valid
+		out = &compressWriter{zw, out}
+	case flags&flagGzip != 0:
+		out = &compressWriter{gzip.NewWriter(out), out}
+	}
+	return out, nil
+}
+
+// readOptions reads the option flags of a version 3 stream, noting
+// them in info, and sets up the reader to undo them.
+func readOptions(rdr io.Reader, info *StreamInfo) (io.Reader, error) {
+	flags := make([]byte, 1)
+	if _, err := io.ReadFull(rdr, flags); err != nil {
+		return nil, err
+	}
+	if flags[0]&^knownFlags != 0 || flags[0]&(flagFlate|flagGzip) == flagFlate|flagGzip {
+		return nil, ErrUnsupported
+	}
+
+	if flags[0]&flagChunked != 0 {
+		info.Padded = true
+		rdr = &chunkReader{r: rdr}
+	}
+	switch {
+	case flags[0]&flagFlate != 0:
+		info.Compress = CompressFlate
+		rdr = truncReader{flate.NewReader(rdr)}
+	case flags[0]&flagGzip != 0:
+		info.Compress = CompressGzip
+		zr, err := gzip.NewReader(rdr)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		rdr = truncReader{zr}
+	}
+	return rdr, nil
+}
+
+// truncReader reports compressed data which is cut off as
+// ErrTruncated, like the other layers do, rather than as the
+// decompressor's own errors.
+type truncReader struct {
+	r io.Reader
+}
+
+func (tr truncReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if cerr, ok := err.(flate.CorruptInputError); ok {
+		err = fmt.Errorf("compressed data is damaged or cut off (%v): %w", cerr, ErrTruncated)
+	} else if err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return n, err
+}
+
+// compressWriter finishes the compressed data before closing
+// the layer below it.
+type compressWriter struct {
+	io.WriteCloser
+	next io.Closer
+}
+
+func (cw *compressWriter) Close() error {
+	if err := cw.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return cw.next.Close()
+}
+
+// countingWriter keeps track of how much has been written to
+// the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// nopCloser gives an io.Writer a Close method that does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// padWriter frames the data in chunks of up to chunkSize bytes, each
+// preceded by its 4-byte length.  On Close, it writes an empty chunk,
+// the 8-byte total length of the data, and then enough padding to bring
+// the whole stream up to the padded size.
+type padWriter struct {
+	w     io.Writer       // the encrypting writer
+	count *countingWriter // bytes written to the sink so far
+	pad   Padding
+	buf   []byte // data waiting to be written as a chunk
+	total int64  // the length of the data
+	err   error
+}
+
+func (pw *padWriter) writeChunk(p []byte) {
+	if pw.err != nil {
+		return
+	}
+	var lenbytes [4]byte
+	binary.BigEndian.PutUint32(lenbytes[:], uint32(len(p)))
+	if _, pw.err = pw.w.Write(lenbytes[:]); pw.err == nil {
+		_, pw.err = pw.w.Write(p)
+	}
+}
+
+func (pw *padWriter) Write(p []byte) (int, error) {
+	if pw.err != nil {
+		return 0, pw.err
+	}
+	pw.buf = append(pw.buf, p...)
+	for len(pw.buf) >= chunkSize {
+		pw.writeChunk(pw.buf[:chunkSize])
+		pw.buf = pw.buf[chunkSize:]
+	}
+	pw.total += int64(len(p))
+	if pw.err != nil {
+		return 0, pw.err
+	}
+	return len(p), nil
+}
+
+// Close writes the last of the data, the final chunk, and the padding.
+func (pw *padWriter) Close() error {
+	if len(pw.buf) > 0 {
+		pw.writeChunk(pw.buf)
+		pw.buf = nil
+	}
+	if pw.err != nil {
+		return pw.err
+	}
+
+	var final [12]byte
+	binary.BigEndian.PutUint64(final[4:], uint64(pw.total))
+	if _, pw.err = pw.w.Write(final[:]); pw.err != nil {
+		return pw.err
+	}
+
+	// the padding is encrypted zeros, which look like the rest of the stream
+	remaining := pw.pad.Size(pw.count.n) - pw.count.n
+	zeros := make([]byte, chunkSize)
+	for remaining > 0 && pw.err == nil {
+		amt := int64(len(zeros))
+		if remaining < amt {
+			amt = remaining
+		}
+		_, pw.err = pw.w.Write(zeros[:amt])
+		remaining -= amt
+	}
+	return pw.err
+}
+
+// chunkReader reads the data written by padWriter, stopping at the
+// final chunk and ignoring the padding after it.
+type chunkReader struct {
+	r     io.Reader
+	left  int   // bytes left in the current chunk
+	total int64 // bytes of data read so far
+	err   error
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+
+	if cr.left == 0 {
+		var lenbytes [4]byte
+		if _, cr.err = io.ReadFull(cr.r, lenbytes[:]); cr.err != nil {
+			cr.err = truncated(cr.err)
+			return 0, cr.err
+		}
+		cr.left = int(binary.BigEndian.Uint32(lenbytes[:]))
+		if cr.left > chunkSize {
+			cr.err = ErrUnsupported
+			return 0, cr.err
+		}
+
+		if cr.left == 0 {
+			// the final chunk... make sure we got all of the data
+			var total [8]byte
+			if _, cr.err = io.ReadFull(cr.r, total[:]); cr.err != nil {
+				cr.err = truncated(cr.err)
+				return 0, cr.err
+			}
+			if int64(binary.BigEndian.Uint64(total[:])) != cr.total {
+				cr.err = ErrTruncated
+				return 0, cr.err
+			}
+			cr.err = io.EOF
+			return 0, cr.err
+		}
+	}
+
+	if len(p) > cr.left {
+		p = p[:cr.left]
+	}
+	n, err := cr.r.Read(p)
+	cr.left -= n
+	cr.total += int64(n)
+	if err == io.EOF {
+		err = ErrTruncated
+	}
+	cr.err = err
+	return n, err
+}
+
+// truncated turns an early end of the stream into ErrTruncated.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package spritz
+
+import "io"
+
+// ProgressReader wraps an io.Reader, calling Report after every
+// read with the number of bytes that read produced.  It is a simple
+// way to keep track of a long-running encryption or hash, e.g.:
+//
+//	src := &spritz.ProgressReader{R: infile, Report: func(n int) { total += int64(n) }}
+//	io.Copy(shash, src)
+//
+// Report is called from whichever goroutine is reading, so it must do
+// its own synchronization if the count is shared.
+type ProgressReader struct {
+	R      io.Reader
+	Report func(n int)
+}
+
+// Read reads from the underlying reader, and reports the
+// number of bytes read.
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	n, err := p.R.Read(b)
+	if n > 0 && p.Report != nil {
+		p.Report(n)
+	}
+	return n, err
+}
@@ -0,0 +1,69 @@
+package spritz
+
+// ---------------------------------------
+// a random number generator, mixing
+// crypto/rand through the sponge
+// ---------------------------------------
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// how many fresh bytes from crypto/rand are absorbed for each read
+const randomReseed = 32
+
+// Random generates random bytes by absorbing fresh bytes from
+// crypto/rand into a spritz sponge before each read, and dripping
+// the output from it.  It is safe for concurrent use.
+type Random struct {
+	mu sync.Mutex
+	s  state
+}
+
+// NewRandom gives a Random.  It takes nothing from crypto/rand until
+// the first Read, so it can't fail.
+func NewRandom() *Random {
+	r := new(Random)
+	initialize(&r.s)
+	absorbMany(&r.s, []byte("spritz random"))
+	absorbStop(&r.s)
+	return r
+}
+
+// Read fills p with random bytes.  It only fails if crypto/rand does.
+func (r *Random) Read(p []byte) (int, error) {
+	var fresh [randomReseed]byte
+	if _, err := rand.Read(fresh[:]); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	absorbMany(&r.s, fresh[:])
+	absorbStop(&r.s)
+	dripMany(&r.s, p)
+	return len(p), nil
+}
+
+// Intn gives a uniformly random number in [0, n).
+func (r *Random) Intn(n int) (int, error) {
+	if n <= 0 || uint64(n) > 1<<32 {
+		return 0, errors.New("spritz: bad argument to Intn")
+	}
+
+	// reject the values past the last whole multiple of n, so that
+	// every answer is equally likely
+	limit := (1 << 32) / uint64(n) * uint64(n)
+	var buf [4]byte
+	for {
+		if _, err := r.Read(buf[:]); err != nil {
+			return 0, err
+		}
+		if v := uint64(binary.BigEndian.Uint32(buf[:])); v < limit {
+			return int(v % uint64(n)), nil
+		}
+	}
+}
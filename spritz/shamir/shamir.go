@@ -0,0 +1,107 @@
+// Package shamir splits a secret into shares, so that any threshold
+// number of them rebuilds the secret, while fewer tell nothing about it.
+//
+// This is Shamir's secret sharing over GF(256): each byte of the
+// secret is the constant term of a random polynomial of degree
+// threshold-1, and a share holds the polynomial's values at one
+// point.  A share is the point (1 to 255) followed by one byte for
+// each byte of the secret.
+package shamir
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrBadShares is returned by Combine when the shares don't fit
+// together: they differ in length, or repeat a point.
+var ErrBadShares = errors.New("shamir: inconsistent shares")
+
+// mul multiplies in GF(256), with the polynomial x^8+x^4+x^3+x+1.
+// It avoids tables, whose lookups would depend on the secret.
+func mul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		p ^= a & -(b & 1)
+		a = (a << 1) ^ (0x1b & -(a >> 7))
+		b >>= 1
+	}
+	return p
+}
+
+// inv gives the multiplicative inverse of a nonzero a, as a^254.
+func inv(a byte) byte {
+	r := a
+	for idx := 0; idx < 6; idx++ {
+		r = mul(mul(r, r), a)
+	}
+	return mul(r, r)
+}
+
+// Split divides secret into n shares, any k of which rebuild it,
+// taking the random coefficients from rnd.  It needs 1 <= k <= n <= 255.
+func Split(secret []byte, n, k int, rnd io.Reader) ([][]byte, error) {
+	if k < 1 || n < k || n > 255 {
+		return nil, errors.New("shamir: need 1 <= threshold <= shares <= 255")
+	}
+
+	// coeffs[i] holds the random coefficients for byte i of the secret
+	coeffs := make([][]byte, len(secret))
+	random := make([]byte, len(secret)*(k-1))
+	if _, err := io.ReadFull(rnd, random); err != nil {
+		return nil, err
+	}
+	for idx := range coeffs {
+		coeffs[idx] = random[idx*(k-1) : (idx+1)*(k-1)]
+	}
+
+	shares := make([][]byte, n)
+	for sidx := range shares {
+		x := byte(sidx + 1)
+		share := make([]byte, len(secret)+1)
+		share[0] = x
+		for idx, s := range secret {
+			// Horner's rule, from the highest coefficient down
+			var y byte
+			for c := k - 2; c >= 0; c-- {
+				y = mul(y, x) ^ coeffs[idx][c]
+			}
+			share[idx+1] = mul(y, x) ^ s
+		}
+		shares[sidx] = share
+	}
+	return shares, nil
+}
+
+// Combine rebuilds the secret from shares.  Given fewer shares than
+// the threshold, it can't tell, and gives a wrong secret; the caller
+// should have some other way to check the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 || len(shares[0]) < 1 {
+		return nil, ErrBadShares
+	}
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != len(shares[0]) || share[0] == 0 || seen[share[0]] {
+			return nil, ErrBadShares
+		}
+		seen[share[0]] = true
+	}
+
+	// Lagrange interpolation at 0, where subtraction is xor
+	secret := make([]byte, len(shares[0])-1)
+	for i, si := range shares {
+		var num, den byte = 1, 1
+		for j, sj := range shares {
+			if i != j {
+				num = mul(num, sj[0])
+				den = mul(den, sj[0]^si[0])
+			}
+		}
+		basis := mul(num, inv(den))
+		for idx := range secret {
+			secret[idx] ^= mul(si[idx+1], basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,53 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	if mul(0x57, 0x83) != 0xc1 {
+		t.Errorf("0x57 * 0x83 = %#x, want 0xc1", mul(0x57, 0x83))
+	}
+	for a := 1; a < 256; a++ {
+		if mul(byte(a), inv(byte(a))) != 1 {
+			t.Fatalf("inv(%#x) = %#x is wrong", a, inv(byte(a)))
+		}
+	}
+}
+
+// TestSplit checks that every threshold-sized subset of the shares
+// rebuilds the secret, and that one fewer doesn't.
+func TestSplit(t *testing.T) {
+	secret := make([]byte, 64)
+	rand.Read(secret)
+
+	shares, err := Split(secret, 5, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				got, err := Combine([][]byte{shares[c], shares[a], shares[b]})
+				if err != nil || !bytes.Equal(got, secret) {
+					t.Errorf("shares %d,%d,%d gave the wrong secret <%v>", a, b, c, err)
+				}
+			}
+			if got, _ := Combine([][]byte{shares[a], shares[b]}); bytes.Equal(got, secret) {
+				t.Errorf("shares %d,%d alone gave the secret", a, b)
+			}
+		}
+	}
+
+	if got, err := Combine(shares); err != nil || !bytes.Equal(got, secret) {
+		t.Errorf("all the shares gave the wrong secret <%v>", err)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[0], shares[1]}); err != ErrBadShares {
+		t.Errorf("repeated share gave <%v>", err)
+	}
+	if _, err := Split(secret, 2, 3, rand.Reader); err == nil {
+		t.Errorf("a threshold above the shares was allowed")
+	}
+}
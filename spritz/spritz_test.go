@@ -1,10 +1,16 @@
 package spritz
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/base64"
+	"context"
+	"encoding"
+	"errors"
 	"io"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -42,6 +48,79 @@ func TestHash(t *testing.T) {
 	}
 }
 
+// TestHashMarshal checks that a hash can be saved partway through,
+// restored into a fresh hash, and continued to give the same sum.
+func TestHashMarshal(t *testing.T) {
+	data := make([]byte, 1000)
+	_, _ = rand.Read(data)
+
+	for _, split := range []int{0, 1, 63, 64, 500, 1000} {
+		h := NewHash(512)
+		h.Write(data[:split])
+		state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			t.Fatalf("Error marshaling: %v", err)
+		}
+
+		// the size should come from the saved state, not the new hash
+		h2 := NewHash(256)
+		if err = h2.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			t.Fatalf("Error unmarshaling: %v", err)
+		}
+		h2.Write(data[split:])
+
+		want, got := Sum(512, data), h2.Sum(nil)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Split at %d: resumed hash %x instead of %x", split, got, want)
+		}
+	}
+
+	h := NewHash(256)
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary([]byte("bogus")); err == nil {
+		t.Fatalf("Bad state was accepted")
+	}
+
+	// corrupt states: a huge size, an even w, a past half the
+	// S-box, and an S-box which isn't a permutation
+	good, _ := h.(encoding.BinaryMarshaler).MarshalBinary()
+	regs := len(hashMagic) + 4
+	for name, corrupt := range map[string]func(b []byte){
+		"size":  func(b []byte) { b[len(hashMagic)] = 0x7f },
+		"w":     func(b []byte) { b[regs+5] = 2 },
+		"a":     func(b []byte) { b[regs+4] = 200 },
+		"S-box": func(b []byte) { b[regs+6] = b[regs+7] },
+	} {
+		state := append([]byte(nil), good...)
+		corrupt(state)
+		if err := NewHash(256).(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err == nil {
+			t.Fatalf("A state with a corrupt %s was accepted", name)
+		}
+	}
+}
+
+// TestProgressReader checks that every byte read gets reported.
+func TestProgressReader(t *testing.T) {
+	data := make([]byte, 5000)
+	_, _ = rand.Read(data)
+
+	var total, calls int
+	src := &ProgressReader{R: bytes.NewReader(data), Report: func(n int) {
+		total += n
+		calls++
+	}}
+
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, src); err != nil {
+		t.Fatalf("Error copying: %v", err)
+	}
+	if total != len(data) || calls == 0 {
+		t.Fatalf("Reported %d bytes in %d calls, instead of %d", total, calls, len(data))
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("ProgressReader changed the data!")
+	}
+}
+
 // TestReadWrite ensures that the code can decrypt bytes that it just
 // encrypted.
 func TestReadWrite(t *testing.T) {
@@ -98,6 +177,604 @@ func TestReadWrite(t *testing.T) {
 	}
 }
 
+// TestContext checks that the context-aware helpers round-trip, and
+// that they stop once the context is cancelled.
+func TestContext(t *testing.T) {
+	data := make([]byte, 3000)
+	_, _ = rand.Read(data)
+
+	var decbuf bytes.Buffer
+	ctx := context.Background()
+	for _, version := range []int{HeaderV1, HeaderV2, HeaderV3} {
+		var encbuf bytes.Buffer
+		if _, err := EncryptContext(ctx, &encbuf, bytes.NewReader(data), "pw", "name", version); err != nil {
+			t.Fatalf("Error encrypting version %d: %v", version, err)
+		}
+		if _, got, err := readHeader(bytes.NewReader(encbuf.Bytes()), "pw"); err != nil || got != version {
+			t.Fatalf("Asked for version %d, but wrote version %d (error <%v>)", version, got, err)
+		}
+		decbuf.Reset()
+		decn, n, err := DecryptContext(ctx, &decbuf, &encbuf, "pw")
+		if err != nil {
+			t.Fatalf("Error decrypting version %d: %v", version, err)
+		}
+		if decn != "name" || n != int64(len(data)) || !bytes.Equal(decbuf.Bytes(), data) {
+			t.Fatalf("Decrypted <%s> with %d bytes, which doesn't match", decn, n)
+		}
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if n, err := CopyContext(cctx, &decbuf, bytes.NewReader(data)); err != context.Canceled || n != 0 {
+		t.Fatalf("Copy with a cancelled context gave %d bytes and error <%v>", n, err)
+	}
+}
+
+// TestHeaderV2 checks the version 2 header: round trips, the specific
+// errors for each failed check, and changing the password.
+func TestHeaderV2(t *testing.T) {
+	data := []byte("some secret data")
+
+	var encbuf bytes.Buffer
+	wtr, err := WrapWriterVersion(&encbuf, "pw", "name", HeaderV2)
+	if err != nil {
+		t.Fatalf("Error wrapping writer: %v", err)
+	}
+	wtr.Write(data)
+	enc := encbuf.Bytes()
+
+	if string(enc[:4]) != magicV2 {
+		t.Fatalf("Header doesn't start with the magic number: %x", enc[:4])
+	}
+
+	// wrong password
+	if _, _, err = WrapReader(bytes.NewReader(enc), "wrong"); err != ErrWrongPassword {
+		t.Fatalf("Wrong password gave error <%v>", err)
+	}
+
+	// damage the encrypted key
+	damaged := append([]byte(nil), enc...)
+	damaged[len(magicV2)+saltSize+verifierSize+10] ^= 1
+	if _, _, err = WrapReader(bytes.NewReader(damaged), "pw"); err != ErrCorruptHeader {
+		t.Fatalf("Damaged key gave error <%v>", err)
+	}
+
+	// truncated header
+	if _, _, err = WrapReader(bytes.NewReader(enc[:40]), "pw"); err != ErrTruncatedHeader {
+		t.Fatalf("Truncated header gave error <%v>", err)
+	}
+
+	// change the password, and make sure the header stays v2
+	fl, err := ioutil.TempFile("", "spritz-test")
+	if err != nil {
+		t.Fatalf("Error making temp file: %v", err)
+	}
+	defer os.Remove(fl.Name())
+	fl.Write(enc)
+	fl.Close()
+
+	if err = RePasswd("pw", "newpw", fl.Name()); err != nil {
+		t.Fatalf("Error changing password: %v", err)
+	}
+	enc, _ = ioutil.ReadFile(fl.Name())
+	if string(enc[:4]) != magicV2 {
+		t.Fatalf("RePasswd didn't keep the v2 header")
+	}
+
+	rdr, decn, err := WrapReader(bytes.NewReader(enc), "newpw")
+	if err != nil {
+		t.Fatalf("Error wrapping reader: %v", err)
+	}
+	dec, _ := ioutil.ReadAll(rdr)
+	if decn != "name" || !bytes.Equal(dec, data) {
+		t.Fatalf("Decrypted <%s> <%s> instead of the original", decn, dec)
+	}
+}
+
+// TestPadding checks that padded streams round-trip, come out at the
+// padded size, and notice when they are truncated.
+func TestPadding(t *testing.T) {
+	pads := []Padding{
+		{Policy: PadNone},
+		{Policy: PadPadme},
+		{Policy: PadPowerOfTwo},
+		{Policy: PadBlock, Block: 4096},
+	}
+
+	for _, pad := range pads {
+		for _, datalen := range []int{0, 1000, chunkSize + 17} {
+			data := make([]byte, datalen)
+			_, _ = rand.Read(data)
+
+			var encbuf bytes.Buffer
+			wtr, err := WrapWriterOptions(&encbuf, "pw", "name", Options{Pad: pad})
+			if err != nil {
+				t.Fatalf("Error wrapping writer: %v", err)
+			}
+			wtr.Write(data)
+			if err = wtr.Close(); err != nil {
+				t.Fatalf("Error closing writer: %v", err)
+			}
+
+			enc := encbuf.Bytes()
+			if pad.Policy != PadNone && int64(len(enc)) != pad.Size(int64(len(enc))) {
+				t.Fatalf("Policy %v gave unpadded size %d", pad, len(enc))
+			}
+
+			rdr, _, err := WrapReader(bytes.NewReader(enc), "pw")
+			if err != nil {
+				t.Fatalf("Error wrapping reader: %v", err)
+			}
+			dec, err := ioutil.ReadAll(rdr)
+			if err != nil || !bytes.Equal(dec, data) {
+				t.Fatalf("Policy %v, length %d: decryption failed <%v>", pad, datalen, err)
+			}
+
+			if pad.Policy != PadNone && datalen > 0 {
+				// cut the stream off in the middle of the data
+				hdrlen := len(magicV3) + saltSize + verifierSize + 64 + keyCheckSize + 1 + len("name") + 1
+				cut := hdrlen + 4 + datalen/2
+				rdr, _, err = WrapReader(bytes.NewReader(enc[:cut]), "pw")
+				if err != nil {
+					t.Fatalf("Error wrapping truncated reader: %v", err)
+				}
+				if _, err = ioutil.ReadAll(rdr); err != ErrTruncated {
+					t.Fatalf("Policy %v: truncated stream gave error <%v>", pad, err)
+				}
+			}
+		}
+	}
+
+	// 9000 is 14 bits, so Padmé rounds to a multiple of 2^(13-4)
+	if got := (Padding{Policy: PadPadme}).Size(9000); got != 9216 {
+		t.Fatalf("Padme of 9000 gave %d instead of 9216", got)
+	}
+}
+
+// TestCompression round-trips compressed streams, with and without
+// padding, and checks that text actually gets smaller.
+func TestCompression(t *testing.T) {
+	data := bytes.Repeat([]byte("a line of a very repetitive log file\n"), 5000)
+
+	for _, comp := range []Compression{CompressNone, CompressFlate, CompressGzip} {
+		for _, pad := range []PadPolicy{PadNone, PadPadme} {
+			var encbuf bytes.Buffer
+			wtr, err := WrapWriterOptions(&encbuf, "pw", "log.txt", Options{Compress: comp, Pad: Padding{Policy: pad}})
+			if err != nil {
+				t.Fatalf("Error wrapping writer: %v", err)
+			}
+			wtr.Write(data)
+			if err = wtr.Close(); err != nil {
+				t.Fatalf("Error closing writer: %v", err)
+			}
+
+			if comp != CompressNone && encbuf.Len() > len(data)/5 {
+				t.Fatalf("Compression %v only got %d bytes down to %d", comp, len(data), encbuf.Len())
+			}
+
+			rdr, name, err := WrapReader(bytes.NewReader(encbuf.Bytes()), "pw")
+			if err != nil || name != "log.txt" {
+				t.Fatalf("Error wrapping reader: %v", err)
+			}
+			dec, err := ioutil.ReadAll(rdr)
+			if err != nil || !bytes.Equal(dec, data) {
+				t.Fatalf("Compression %v, padding %v: decryption failed <%v>", comp, pad, err)
+			}
+
+			// a stream cut short is reported as such, whatever the layers
+			if comp != CompressNone {
+				rdr, _, err = WrapReader(bytes.NewReader(encbuf.Bytes()[:encbuf.Len()-20]), "pw")
+				if err == nil {
+					_, err = ioutil.ReadAll(rdr)
+				}
+				if !errors.Is(err, ErrTruncated) {
+					t.Fatalf("Compression %v, padding %v: a cut-off stream gave error <%v>", comp, pad, err)
+				}
+			}
+		}
+	}
+
+	if _, err := WrapWriterOptions(ioutil.Discard, "pw", "", Options{Compress: 99}); err != ErrUnsupported {
+		t.Fatalf("Unknown compression gave error <%v>", err)
+	}
+}
+
+// TestStreamInfo checks that WrapReaderInfo tells how each kind of
+// stream was written, so that it can be written the same way again.
+func TestStreamInfo(t *testing.T) {
+	data := []byte("some secret data")
+	for _, want := range []StreamInfo{
+		{Version: HeaderV1},
+		{Version: HeaderV2},
+		{Version: HeaderV3},
+		{Version: HeaderV3, Padded: true},
+		{Version: HeaderV3, Compress: CompressGzip},
+		{Version: HeaderV3, Padded: true, Compress: CompressFlate},
+	} {
+		var encbuf bytes.Buffer
+		var wtr io.WriteCloser
+		var err error
+		if !want.Padded && want.Compress == CompressNone {
+			var w io.Writer
+			w, err = WrapWriterVersion(&encbuf, "pw", "name", want.Version)
+			wtr = nopCloser{w}
+		} else {
+			opts := Options{Compress: want.Compress}
+			if want.Padded {
+				opts.Pad.Policy = PadPowerOfTwo
+			}
+			wtr, err = WrapWriterOptions(&encbuf, "pw", "name", opts)
+		}
+		if err != nil {
+			t.Fatalf("Error wrapping writer: %v", err)
+		}
+		wtr.Write(data)
+		if err = wtr.Close(); err != nil {
+			t.Fatalf("Error closing writer: %v", err)
+		}
+
+		rdr, _, got, err := WrapReaderInfo(bytes.NewReader(encbuf.Bytes()), "pw")
+		if err != nil || got != want {
+			t.Fatalf("Wrote %+v, but read back %+v <%v>", want, got, err)
+		}
+		if dec, err := ioutil.ReadAll(rdr); err != nil || !bytes.Equal(dec, data) {
+			t.Fatalf("%+v: decryption failed <%v>", want, err)
+		}
+	}
+}
+
+// TestDeterministic checks that deterministic encryption repeats
+// itself only when it should, and reads back as usual.
+func TestDeterministic(t *testing.T) {
+	encrypt := func(context string, data []byte) []byte {
+		var buf bytes.Buffer
+		if err := EncryptDeterministic(&buf, "pw", context, "secret.txt", data); err != nil {
+			t.Fatalf("Error encrypting: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	data := []byte("api_key: 12345\n")
+	first := encrypt("config/secret.txt", data)
+	if !bytes.Equal(first, encrypt("config/secret.txt", data)) {
+		t.Fatalf("Same inputs gave different outputs")
+	}
+	if bytes.Equal(first[:64], encrypt("other/secret.txt", data)[:64]) {
+		t.Fatalf("Different contexts gave the same header")
+	}
+	if bytes.Equal(first[:64], encrypt("config/secret.txt", []byte("api_key: 12346\n"))[:64]) {
+		t.Fatalf("Different data gave the same header")
+	}
+	if !HasHeader(first) || HasHeader(data) {
+		t.Fatalf("HasHeader got the wrong answer")
+	}
+
+	rdr, name, err := WrapReader(bytes.NewReader(first), "pw")
+	if err != nil || name != "secret.txt" {
+		t.Fatalf("Error wrapping reader: %v", err)
+	}
+	dec, err := ioutil.ReadAll(rdr)
+	if err != nil || !bytes.Equal(dec, data) {
+		t.Fatalf("Decryption failed <%v>", err)
+	}
+
+	// the salt in the clear comes from the stretched password, so
+	// checking a guess at it means stretching the guess first
+	salt := first[len(magicV2) : len(magicV2)+saltSize]
+	seedSalt := func(key []byte) []byte {
+		rnd := dripReader{deterministicSeed(key, "config/secret.txt", "secret.txt", data)}
+		rnd.Read(make([]byte, 64)) // the real key
+		s := make([]byte, saltSize)
+		rnd.Read(s)
+		return s
+	}
+	if bytes.Equal(seedSalt([]byte("pw")), salt) {
+		t.Fatalf("The salt came from the unstretched password")
+	}
+	if !bytes.Equal(seedSalt(deterministicKey("pw", "config/secret.txt")), salt) {
+		t.Fatalf("The salt didn't come from the stretched password")
+	}
+}
+
+// TestRandom makes sure the generator gives fresh bytes, and that
+// Intn stays in its range.
+func TestRandom(t *testing.T) {
+	r := NewRandom()
+	a, b := make([]byte, 32), make([]byte, 32)
+	r.Read(a)
+	r.Read(b)
+	if bytes.Equal(a, b) {
+		t.Fatalf("Two reads gave the same bytes")
+	}
+
+	var seen [10]int
+	for idx := 0; idx < 1000; idx++ {
+		n, err := r.Intn(10)
+		if err != nil || n < 0 || n >= 10 {
+			t.Fatalf("Intn(10) gave %d <%v>", n, err)
+		}
+		seen[n]++
+	}
+	for n, count := range seen {
+		if count == 0 {
+			t.Fatalf("Intn(10) never gave %d", n)
+		}
+	}
+	if _, err := r.Intn(0); err == nil {
+		t.Fatalf("Intn(0) didn't fail")
+	}
+}
+
+// TestArmor round-trips data through the armor, and checks that
+// damage to it is caught.
+func TestArmor(t *testing.T) {
+	for _, datalen := range []int{0, 1, armorLine, armorLine*3 + 5} {
+		data := make([]byte, datalen)
+		_, _ = rand.Read(data)
+
+		for _, hdrs := range []map[string]string{nil, {"Comment": "a secret", "Version": "1"}} {
+			var buf bytes.Buffer
+			buf.WriteString("some text before the armor\n")
+			wtr, err := NewArmorWriter(&buf, hdrs)
+			if err != nil {
+				t.Fatalf("Error creating armor writer: %v", err)
+			}
+			wtr.Write(data)
+			if err = wtr.Close(); err != nil {
+				t.Fatalf("Error closing armor writer: %v", err)
+			}
+			armored := buf.String()
+
+			if !IsArmored(bufio.NewReader(strings.NewReader(armored))) {
+				t.Fatalf("Armor wasn't detected")
+			}
+
+			rdr, got, err := NewArmorReader(strings.NewReader(armored))
+			if err != nil {
+				t.Fatalf("Error reading armor: %v", err)
+			}
+			dec, err := ioutil.ReadAll(rdr)
+			if err != nil || !bytes.Equal(dec, data) {
+				t.Fatalf("Length %d: armor round-trip failed <%v>", datalen, err)
+			}
+			if len(got) != len(hdrs) || got["Comment"] != hdrs["Comment"] {
+				t.Fatalf("Headers %v came back as %v", hdrs, got)
+			}
+
+			// the line endings of pasted text shouldn't matter
+			rdr, _, err = NewArmorReader(strings.NewReader(strings.Replace(armored, "\n", "\r\n", -1)))
+			if err == nil {
+				dec, err = ioutil.ReadAll(rdr)
+			}
+			if err != nil || !bytes.Equal(dec, data) {
+				t.Fatalf("Length %d: armor with CRLFs failed <%v>", datalen, err)
+			}
+
+			// changing a data line should fail the checksum
+			if datalen > 0 {
+				lines := strings.Split(armored, "\n")
+				idx := len(lines) - 4 // the last data line
+				lines[idx] = strings.Replace(lines[idx], lines[idx][:1], flipB64(lines[idx][0]), 1)
+				rdr, _, err = NewArmorReader(strings.NewReader(strings.Join(lines, "\n")))
+				if err == nil {
+					_, err = ioutil.ReadAll(rdr)
+				}
+				if !errors.Is(err, ErrArmorChecksum) && !errors.Is(err, ErrBadArmor) {
+					t.Fatalf("Damaged armor gave error <%v>", err)
+				}
+			}
+		}
+	}
+
+	if IsArmored(bufio.NewReader(strings.NewReader("not armor"))) {
+		t.Fatalf("Plain text was detected as armor")
+	}
+
+	// IsArmored and NewArmorReader look equally far for the BEGIN line
+	var buf bytes.Buffer
+	wtr, _ := NewArmorWriter(&buf, nil)
+	wtr.Write([]byte("data"))
+	wtr.Close()
+	for _, skip := range []int{10, armorMaxSkip - len(armorBegin) - 1, armorMaxSkip - len(armorBegin), armorMaxSkip} {
+		armored := strings.Repeat("x", skip-1) + "\n" + buf.String()
+		_, _, err := NewArmorReader(strings.NewReader(armored))
+		if found := IsArmored(bufio.NewReader(strings.NewReader(armored))); found != (err == nil) {
+			t.Fatalf("After %d bytes, IsArmored says %v but NewArmorReader gave <%v>", skip, found, err)
+		}
+	}
+}
+
+// flipB64 gives a different base64 character than c.
+func flipB64(c byte) string {
+	if c == 'A' {
+		return "B"
+	}
+	return "A"
+}
+
+// TestRestoreHeader reads the key out of streams of each version,
+// and uses it to give them a new password.
+func TestRestoreHeader(t *testing.T) {
+	data := []byte("some secret data")
+	for _, version := range []int{HeaderV1, HeaderV2, HeaderV3} {
+		var encbuf bytes.Buffer
+		wtr, err := WrapWriterVersion(&encbuf, "pw", "name", version)
+		if err != nil {
+			t.Fatalf("Error wrapping writer: %v", err)
+		}
+		wtr.Write(data)
+
+		key, gotVersion, err := ReadKey(bytes.NewReader(encbuf.Bytes()), "pw")
+		if err != nil || gotVersion != version || len(key) != KeySize {
+			t.Fatalf("v%d: ReadKey gave version %d <%v>", version, gotVersion, err)
+		}
+		if KeyID(key) == KeyID(make([]byte, KeySize)) {
+			t.Fatalf("v%d: KeyID didn't depend on the key", version)
+		}
+
+		var restored bytes.Buffer
+		if err = RestoreHeader(&restored, bytes.NewReader(encbuf.Bytes()), key, "newpw"); err != nil {
+			t.Fatalf("v%d: Error restoring header: %v", version, err)
+		}
+		enc := restored.Bytes()
+		if len(enc) != encbuf.Len() {
+			t.Fatalf("v%d: RestoreHeader changed the size from %d to %d", version, encbuf.Len(), len(enc))
+		}
+		rdr, decn, err := WrapReader(bytes.NewReader(enc), "newpw")
+		if err != nil {
+			t.Fatalf("v%d: Error wrapping reader: %v", version, err)
+		}
+		dec, _ := ioutil.ReadAll(rdr)
+		if decn != "name" || !bytes.Equal(dec, data) {
+			t.Fatalf("v%d: Decrypted <%s> <%s> instead of the original", version, decn, dec)
+		}
+
+		// the key of another stream is caught before anything is
+		// written... but about one in 256 decrypts to an empty name,
+		// which can't be told from the real thing
+		other := make([]byte, KeySize)
+		for tries := 0; tries < 3 && err != ErrWrongKey; tries++ {
+			rand.Read(other)
+			restored.Reset()
+			err = RestoreHeader(&restored, bytes.NewReader(encbuf.Bytes()), other, "newpw")
+		}
+		if err != ErrWrongKey || restored.Len() > 0 {
+			t.Fatalf("v%d: A wrong key gave error <%v>, after writing %d bytes", version, err, restored.Len())
+		}
+	}
+}
+
+// TestRecoveryCode round-trips keys through recovery codes, and
+// checks that copying mistakes are caught.
+func TestRecoveryCode(t *testing.T) {
+	key := make([]byte, KeySize)
+	rand.Read(key)
+	code := RecoveryCode(key)
+
+	for _, copied := range []string{code, strings.ToLower(code), strings.Replace(code, "-", " ", -1),
+		strings.Replace(strings.Replace(code, "O", "0", -1), "I", "1", -1)} {
+		got, err := ParseRecoveryCode(copied)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Fatalf("Code %q didn't give back the key <%v>", copied, err)
+		}
+	}
+
+	// change one character
+	bad := []byte(code)
+	if bad[10] == 'A' {
+		bad[10] = 'B'
+	} else {
+		bad[10] = 'A'
+	}
+	for _, copied := range []string{string(bad), code[:len(code)-4], code + "-AAAA", code + "?"} {
+		if _, err := ParseRecoveryCode(copied); err != ErrBadRecoveryCode {
+			t.Fatalf("Code %q gave <%v>", copied, err)
+		}
+	}
+}
+
+// TestRecoveryArmored backs up the key of an armored stream as a
+// recovery code, and restores it under a new password, keeping the
+// armor and its headers.
+func TestRecoveryArmored(t *testing.T) {
+	data := []byte("some secret data")
+	var armored bytes.Buffer
+	aw, _ := NewArmorWriter(&armored, map[string]string{"Comment": "test"})
+	wtr, err := WrapWriterVersion(aw, "pw", "name", HeaderV2)
+	if err != nil {
+		t.Fatalf("Error wrapping writer: %v", err)
+	}
+	wtr.Write(data)
+	aw.Close()
+
+	rdr, _, err := NewArmorReader(bytes.NewReader(armored.Bytes()))
+	if err != nil {
+		t.Fatalf("Error reading armor: %v", err)
+	}
+	key, _, err := ReadKey(rdr, "pw")
+	if err != nil {
+		t.Fatalf("Error reading key: %v", err)
+	}
+	if key, err = ParseRecoveryCode(RecoveryCode(key)); err != nil {
+		t.Fatalf("Error parsing recovery code: %v", err)
+	}
+
+	rdr, headers, err := NewArmorReader(bytes.NewReader(armored.Bytes()))
+	if err != nil {
+		t.Fatalf("Error reading armor: %v", err)
+	}
+	var restored bytes.Buffer
+	aw, _ = NewArmorWriter(&restored, headers)
+	if err = RestoreHeader(aw, rdr, key, "newpw"); err != nil {
+		t.Fatalf("Error restoring header: %v", err)
+	}
+	aw.Close()
+
+	br := bufio.NewReader(&restored)
+	if !IsArmored(br) {
+		t.Fatalf("The restored stream lost its armor")
+	}
+	rdr, headers, err = NewArmorReader(br)
+	if err != nil || headers["Comment"] != "test" {
+		t.Fatalf("The restored armor has headers %v <%v>", headers, err)
+	}
+	rdr, decn, err := WrapReader(rdr, "newpw")
+	if err != nil {
+		t.Fatalf("Error wrapping reader: %v", err)
+	}
+	dec, err := ioutil.ReadAll(rdr)
+	if err != nil || decn != "name" || !bytes.Equal(dec, data) {
+		t.Fatalf("Decrypted <%s> <%s> instead of the original <%v>", decn, dec, err)
+	}
+}
+
+// TestAEAD seals and opens messages, and checks that any change to
+// the message, nonce or additional data is caught.
+func TestAEAD(t *testing.T) {
+	key := []byte("the key")
+	aead := NewAEAD(key)
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+
+	for _, size := range []int{0, 1, 63, 64, 65, 1000} {
+		msg := make([]byte, size)
+		rand.Read(msg)
+		sealed := aead.Seal([]byte("prefix"), nonce, msg, []byte("ad"))
+		if !bytes.HasPrefix(sealed, []byte("prefix")) || len(sealed) != 6+size+aead.Overhead() {
+			t.Fatalf("Sealed %d bytes into %d", size, len(sealed))
+		}
+		sealed = sealed[6:]
+		if size > 8 && bytes.Contains(sealed, msg) {
+			t.Fatalf("Sealed message includes the plaintext")
+		}
+
+		got, err := aead.Open(nil, nonce, sealed, []byte("ad"))
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Fatalf("Size %d didn't open <%v>", size, err)
+		}
+
+		damaged := append([]byte(nil), sealed...)
+		damaged[rand.Intn(len(damaged))] ^= 4
+		otherNonce := append([]byte(nil), nonce...)
+		otherNonce[0] ^= 1
+		for _, test := range []struct {
+			nonce, sealed, ad []byte
+		}{
+			{nonce, damaged, []byte("ad")},
+			{otherNonce, sealed, []byte("ad")},
+			{nonce, sealed, []byte("AD")},
+			{nonce, sealed[1:], []byte("ad")},
+		} {
+			if _, err = aead.Open(nil, test.nonce, test.sealed, test.ad); err != ErrAuthFailed {
+				t.Fatalf("Size %d: changed message gave <%v>", size, err)
+			}
+		}
+		if _, err = NewAEAD([]byte("other key")).Open(nil, nonce, sealed, []byte("ad")); err != ErrAuthFailed {
+			t.Fatalf("Size %d: wrong key gave <%v>", size, err)
+		}
+	}
+}
+
 // TestReadKnown ensures that the code can decrypt a known good message
 func TestReadKnown(t *testing.T) {
 
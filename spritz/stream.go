@@ -7,16 +7,58 @@ package spritz
 // ---------------------------------------
 
 import (
-	"bytes"
 	"crypto/cipher"
 	"crypto/rand"
-	"fmt"
+	"crypto/subtle"
+	"errors"
 	"io"
 	"os"
 
 	"github.com/rwtodd/Go.AppUtil/errs"
 )
 
+// ErrBadPassword is returned by WrapReader and RePasswd when the
+// 32-bit password check in a version 1 header fails.  That check can't
+// tell a wrong password from a corrupted file.
+var ErrBadPassword = errors.New("Bad pw or corrupted file!")
+
+// ErrWrongPassword is returned when the 256-bit password verifier
+// in a version 2 header doesn't match.
+var ErrWrongPassword = errors.New("wrong password")
+
+// ErrCorruptHeader is returned when the password in a version 2
+// header checks out, but the stored key is damaged.
+var ErrCorruptHeader = errors.New("corrupted header")
+
+// ErrTruncatedHeader is returned when the input ends before
+// the header is complete.
+var ErrTruncatedHeader = errors.New("file too short to hold a header")
+
+// Header versions.  Version 1 checks the password with a 32-bit hash,
+// which about one in four billion wrong passwords will pass.  Version 2
+// starts with a magic number, and checks the password with a 256-bit
+// verifier derived from the generated key.  Version 3 has the same header
+// as version 2, but the stream stores its format options (see Options)
+// after the filename.
+const (
+	HeaderV1 = 1
+	HeaderV2 = 2
+	HeaderV3 = 3
+)
+
+// magic numbers starting the version 2 and 3 headers.
+const (
+	magicV2 = "SPZ\x02"
+	magicV3 = "SPZ\x03"
+)
+
+// sizes of the parts of a version 2 header
+const (
+	saltSize     = 16
+	verifierSize = 32
+	keyCheckSize = 32
+)
+
 func (s *state) XORKeyStream(dst, src []byte) {
 	if len(dst) < len(src) {
 		panic("Bad args to XORKeyStream!")
@@ -56,14 +98,74 @@ func keygen(pw string, iv []byte, times int) []byte {
 	return ans
 }
 
+// headerError turns the errors from reading a short header into
+// ErrTruncatedHeader.
+func headerError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncatedHeader
+	}
+	return err
+}
+
+// v2Keys derives the password verifier, and the cipher that protects
+// the real key, from the password and salt of a version 2 header.
+func v2Keys(pw string, salt []byte) (verifier []byte, crypto *state) {
+	iv := append([]byte(nil), salt...) // keygen destroys its IV
+	key := keygen(pw, iv, 20000+int(salt[3]))
+
+	verifier = Sum(verifierSize*8, append([]byte("spritz verifier"), key...))
+
+	crypto = new(state)
+	initialize(crypto)
+	absorbMany(crypto, key)
+	return
+}
+
+// readHeaderV2 reads the rest of a version 2 header, after the magic
+// number, checking the password in constant time.
+func readHeaderV2(src io.Reader, pw string) (realKey []byte, err error) {
+	buf := make([]byte, saltSize+verifierSize)
+	if _, err = io.ReadFull(src, buf); err != nil {
+		return nil, headerError(err)
+	}
+	salt, stored := buf[:saltSize], buf[saltSize:]
+
+	verifier, crypto := v2Keys(pw, salt)
+	if subtle.ConstantTimeCompare(verifier, stored) != 1 {
+		return nil, ErrWrongPassword
+	}
+
+	rdr := &cipher.StreamReader{S: crypto, R: src}
+	buf = make([]byte, 64+keyCheckSize)
+	if _, err = io.ReadFull(rdr, buf); err != nil {
+		return nil, headerError(err)
+	}
+	realKey = buf[:64]
+	if subtle.ConstantTimeCompare(Sum(keyCheckSize*8, realKey), buf[64:]) != 1 {
+		return nil, ErrCorruptHeader
+	}
+	return realKey, nil
+}
+
 // reads enough to get the "real" key out of the encrypted
-// stream
-func readHeader(src io.Reader, pw string) (realKey []byte, err error) {
+// stream, along with the version of the header.
+func readHeader(src io.Reader, pw string) (realKey []byte, version int, err error) {
 	iv := make([]byte, 4)
 	if _, err = io.ReadFull(src, iv); err != nil {
+		err = headerError(err)
 		return
 	}
 
+	switch string(iv) {
+	case magicV2:
+		realKey, err = readHeaderV2(src, pw)
+		return realKey, HeaderV2, err
+	case magicV3:
+		realKey, err = readHeaderV2(src, pw)
+		return realKey, HeaderV3, err
+	}
+	version = HeaderV1
+
 	// Stage 1... IV is encrypted against hashed pw...
 	tmp32 := Sum(32, []byte(pw))
 	xorInto(iv, tmp32) // decrypt IV
@@ -80,6 +182,7 @@ func readHeader(src io.Reader, pw string) (realKey []byte, err error) {
 	// decrypt random bytes
 	rbytes := make([]byte, 4)
 	if _, err = io.ReadFull(rdr, rbytes); err != nil {
+		err = headerError(err)
 		return
 	}
 
@@ -94,18 +197,20 @@ func readHeader(src io.Reader, pw string) (realKey []byte, err error) {
 	// decrypt the hash of rbytes
 	remaining := make([]byte, 4)
 	if _, err = io.ReadFull(rdr, remaining); err != nil {
+		err = headerError(err)
 		return
 	}
 
 	// check the hash match
-	if !bytes.Equal(remaining, Sum(32, rbytes)) {
-		err = fmt.Errorf("Bad pw or corrupted file!")
+	if subtle.ConstantTimeCompare(remaining, Sum(32, rbytes)) != 1 {
+		err = ErrBadPassword
 		return
 	}
 
 	// Stage 4... get the real key
 	realKey = make([]byte, 64)
 	if _, err = io.ReadFull(rdr, realKey); err != nil {
+		err = headerError(err)
 		return
 	}
 
@@ -120,11 +225,25 @@ func readHeader(src io.Reader, pw string) (realKey []byte, err error) {
 // WrapWriter, and is just an example of how one may
 // turn the encryption stream into a file format.
 func WrapReader(src io.Reader, pw string) (rdr io.Reader, fn string, err error) {
+	rdr, fn, _, err = WrapReaderInfo(src, pw)
+	return
+}
+
+// WrapReaderInfo is like WrapReader, but also tells how the stream
+// was written, so that it can be written the same way again.
+func WrapReaderInfo(src io.Reader, pw string) (rdr io.Reader, fn string, info StreamInfo, err error) {
 	var realKey []byte
-	realKey, err = readHeader(src, pw)
+	realKey, info.Version, err = readHeader(src, pw)
 	if err != nil {
 		return
 	}
+	return unwrapBody(src, realKey, info.Version)
+}
+
+// unwrapBody sets up the decryption of the stream after its header,
+// reading the filename and, in version 3, the options.
+func unwrapBody(src io.Reader, realKey []byte, version int) (rdr io.Reader, fn string, info StreamInfo, err error) {
+	info.Version = version
 	crypto := new(state)
 	initialize(crypto)
 	absorbMany(crypto, realKey)
@@ -151,6 +270,11 @@ func WrapReader(src io.Reader, pw string) (rdr io.Reader, fn string, err error)
 		fn = string(decnBytes)
 	}
 
+	// version 3 streams have options after the filename
+	if info.Version == HeaderV3 {
+		rdr, err = readOptions(rdr, &info)
+	}
+
 	return
 }
 
@@ -164,7 +288,40 @@ func xorInto(dst, src []byte) {
 
 }
 
-func writeHeader(sink io.Writer, pw string, realKey []byte) error {
+// writeHeaderV2 writes a version 2 (or 3) header: the magic number, a
+// random salt, the password verifier, and then the encrypted real key
+// along with a hash to check it.
+func writeHeaderV2(sink io.Writer, pw string, realKey []byte, magic string, rnd io.Reader) error {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rnd, salt); err != nil {
+		return err
+	}
+
+	verifier, crypto := v2Keys(pw, salt)
+
+	var hdr []byte
+	hdr = append(hdr, magic...)
+	hdr = append(hdr, salt...)
+	hdr = append(hdr, verifier...)
+	_, err1 := sink.Write(hdr)
+
+	writer := &cipher.StreamWriter{S: crypto, W: sink}
+	_, err2 := writer.Write(realKey)
+	_, err3 := writer.Write(Sum(keyCheckSize*8, realKey))
+
+	return errs.First("Writing encryption header", err1, err2, err3)
+}
+
+// writeHeader writes a header of the given version, protecting
+// the real key with the password.
+func writeHeader(sink io.Writer, pw string, realKey []byte, version int) error {
+	switch version {
+	case HeaderV2:
+		return writeHeaderV2(sink, pw, realKey, magicV2, rand.Reader)
+	case HeaderV3:
+		return writeHeaderV2(sink, pw, realKey, magicV3, rand.Reader)
+	}
+
 	var iv = make([]byte, 4)
 	var err1 error
 	if _, err1 = rand.Read(iv); err1 != nil {
@@ -216,17 +373,36 @@ func writeHeader(sink io.Writer, pw string, realKey []byte) error {
 // this is stored in a format that agrees with the
 // expectations of WrapReader, and is just an example of
 // how one may turn the encryption stream into a file format.
+// It writes a version 1 header; see WrapWriterVersion.
 func WrapWriter(sink io.Writer, pw string, origfn string) (io.Writer, error) {
-	var realKey = make([]byte, 64)
-	var err1 error
-	if _, err1 = rand.Read(realKey); err1 != nil {
-		return nil, err1
+	return WrapWriterVersion(sink, pw, origfn, HeaderV1)
+}
+
+// WrapWriterVersion is like WrapWriter, but writes the given
+// header version.  HeaderV2 gives a much stronger password check,
+// but can't be read by versions of this package before it existed.
+// HeaderV3 streams are written with no options; use WrapWriterOptions
+// to select them.
+func WrapWriterVersion(sink io.Writer, pw string, origfn string, version int) (io.Writer, error) {
+	realKey := make([]byte, 64)
+	if _, err := rand.Read(realKey); err != nil {
+		return nil, err
+	}
+	if err := writeHeader(sink, pw, realKey, version); err != nil {
+		return nil, err
 	}
 
-	if err1 = writeHeader(sink, pw, realKey); err1 != nil {
-		return nil, err1
+	writer, err := wrapWriter(sink, realKey, origfn)
+	if err == nil && version == HeaderV3 {
+		_, err = writer.Write([]byte{0})
+		err = errs.Wrap("Writing encryption header", err)
 	}
+	return writer, err
+}
 
+// wrapWriter writes the filename, after the header, and gives the
+// writer for the rest of the stream.
+func wrapWriter(sink io.Writer, realKey []byte, origfn string) (io.Writer, error) {
 	crypto := new(state)
 	initialize(crypto)
 	absorbMany(crypto, realKey)
@@ -248,7 +424,8 @@ func WrapWriter(sink io.Writer, pw string, origfn string) (io.Writer, error) {
 }
 
 // change the password on a given file, without
-// re-encrypting the whole contents
+// re-encrypting the whole contents.  The header keeps
+// its version.
 func RePasswd(oldpw, newpw, fn string) error {
 	fl, err := os.OpenFile(fn, os.O_RDWR, 0666)
 	defer fl.Close()
@@ -257,7 +434,7 @@ func RePasswd(oldpw, newpw, fn string) error {
 		return err
 	}
 
-	realKey, err := readHeader(fl, oldpw)
+	realKey, version, err := readHeader(fl, oldpw)
 	if err != nil {
 		return err
 	}
@@ -267,7 +444,7 @@ func RePasswd(oldpw, newpw, fn string) error {
 		return err
 	}
 
-	err = writeHeader(fl, newpw, realKey)
+	err = writeHeader(fl, newpw, realKey, version)
 
 	return err
 }
@@ -0,0 +1,39 @@
+package strength
+
+import "strings"
+
+// commonList holds some of the most common passwords, most common
+// first, from the published password leaks.
+var commonList = strings.Fields(`
+123456 password 123456789 12345678 12345 qwerty 1234567 111111 123123
+abc123 1234567890 password1 1234 qwerty123 000000 iloveyou dragon
+monkey letmein 654321 sunshine master 666666 princess football shadow
+123321 baseball superman welcome michael qwertyuiop 1q2w3e4r 121212
+admin 7777777 trustno1 login hello freedom whatever qazwsx 1qaz2wsx
+asdfghjkl zxcvbnm asdf batman starwars mustang access 696969 jordan
+harley ranger hunter hunter2 buster soccer hockey killer george charlie
+andrew thomas jessica pepper daniel ginger summer flower cookie ashley
+bailey matrix nicole computer internet corvette maggie merlin cheese
+orange purple silver golden tigger snoopy yankees dallas austin
+thunder taylor matthew robert joshua anthony william jennifer samsung
+google apple secret passw0rd changeme default guest root toor test
+test123 temp qwe123 aa123456 987654321 password123 welcome1 letmein1
+admin123 iloveyou1 monkey1 dragon1 love money lovely angel friends
+family forever michelle liverpool arsenal chelsea loveme pokemon naruto
+minecraft q1w2e3r4 zaq1zaq1 1q2w3e 123qwe qwertz azerty mypassword
+pass 1111 0000 abcdef abcd1234 letmein123 sunshine1 princess1 spritz
+football1 baseball1 superman1 charlie1 jordan23 michael1 secret1
+welcome123 password12 password2 qwerty1 zxcvbnm1 asdfgh 112233 159753
+147258369 11111111 88888888 55555 99999999 31415926 passport
+`)
+
+// commonRank gives each common password's place in the list.
+var commonRank = make(map[string]int)
+
+func init() {
+	for idx, pw := range commonList {
+		if _, dup := commonRank[pw]; !dup {
+			commonRank[pw] = idx
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package strength estimates how hard a password would be to guess.
+//
+// The estimate starts from the length and the kinds of characters in
+// the password, and then looks for the things guessers try first:
+// common passwords (with leetspeak and trailing digits undone),
+// keyboard runs like "qwerty", sequences like "abcd" or "4321",
+// repeated characters, and repeated chunks.  It is a rough guide,
+// meant to catch the obviously bad, not a guarantee.
+package strength
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Level is a coarse rating of a password.
+type Level int
+
+const (
+	VeryWeak   Level = iota // under 28 bits: guessed in moments
+	Weak                    // under 36 bits
+	Fair                    // under 60 bits
+	Strong                  // under 80 bits
+	VeryStrong              // 80 bits or more
+)
+
+var levelNames = []string{"very-weak", "weak", "fair", "strong", "very-strong"}
+
+func (l Level) String() string {
+	if l < VeryWeak || l > VeryStrong {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a level by name (e.g., "fair") or number (0-4).
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for idx, name := range levelNames {
+		if s == name {
+			return Level(idx), nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= int(VeryWeak) && n <= int(VeryStrong) {
+		return Level(n), nil
+	}
+	return VeryWeak, fmt.Errorf("unknown strength %q: want one of %s, or 0-4", s, strings.Join(levelNames, ", "))
+}
+
+// levelOf rates an entropy estimate.
+func levelOf(bits float64) Level {
+	switch {
+	case bits < 28:
+		return VeryWeak
+	case bits < 36:
+		return Weak
+	case bits < 60:
+		return Fair
+	case bits < 80:
+		return Strong
+	}
+	return VeryStrong
+}
+
+// Result is the estimate for a password.
+type Result struct {
+	Bits     float64  // estimated entropy
+	Level    Level    // the rating of Bits
+	Warnings []string // what made the password weaker, if anything
+}
+
+// Estimate rates a password.
+func Estimate(pw string) Result {
+	var res Result
+	if len(pw) == 0 {
+		res.Warnings = append(res.Warnings, "the password is empty")
+		return res
+	}
+
+	pool := poolSize(pw)
+	res.Bits = float64(len([]rune(pw))) * math.Log2(pool)
+
+	if bits, ok := commonBits(pw); ok && bits < res.Bits {
+		res.Bits = bits
+		res.Warnings = append(res.Warnings, "it is (a variation of) a common password")
+	}
+	if bits, found := patternBits(pw, pool); found && bits < res.Bits {
+		res.Bits = bits
+		res.Warnings = append(res.Warnings, "it has keyboard runs, sequences or repeats")
+	}
+	if bits, ok := repeatBits(pw, pool); ok && bits < res.Bits {
+		res.Bits = bits
+		res.Warnings = append(res.Warnings, "it repeats a shorter password")
+	}
+
+	res.Level = levelOf(res.Bits)
+	return res
+}
+
+// poolSize guesses the number of characters the password was drawn
+// from, by the classes of characters in it.
+func poolSize(pw string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range pw {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128 && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	var pool float64
+	for _, class := range []struct {
+		present bool
+		size    float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	return pool
+}
+
+// leet undoes the usual character substitutions.
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// commonBits checks the password against the common ones, allowing
+// for capitals, leetspeak and digits or symbols tacked on the end.
+func commonBits(pw string) (float64, bool) {
+	lower := strings.ToLower(pw)
+	base := strings.TrimRightFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	suffix := len(lower) - len(base)
+
+	for _, cand := range []struct {
+		word  string
+		extra float64 // bits for the variation
+	}{
+		{lower, 0},
+		{leet.Replace(lower), 1},
+		{base, float64(suffix) * math.Log2(10)},
+		{leet.Replace(base), 1 + float64(suffix)*math.Log2(10)},
+	} {
+		if rank, ok := commonRank[cand.word]; ok && len(cand.word) > 0 {
+			bits := math.Log2(float64(rank+1)) + cand.extra
+			if lower != pw {
+				bits++ // for the capitals
+			}
+			return bits, true
+		}
+	}
+	return 0, false
+}
+
+// keyboard rows, for spotting runs like "qwerty" or "7654"
+var keyRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+// adjacent tells if b follows a in a run: the same character, the next
+// or previous character, or the next or previous key on the keyboard.
+// It gives the direction of the step, or 0 if b doesn't follow a.
+func adjacent(a, b rune) int {
+	a, b = unicode.ToLower(a), unicode.ToLower(b)
+	switch b - a {
+	case 0:
+		return 2
+	case 1:
+		return 1
+	case -1:
+		return -1
+	}
+	for _, row := range keyRows {
+		ia, ib := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if ia >= 0 && ib >= 0 {
+			switch ib - ia {
+			case 1:
+				return 1
+			case -1:
+				return -1
+			}
+		}
+	}
+	return 0
+}
+
+// patternBits estimates the entropy when runs of three or more
+// characters are counted as one choice of a start, a direction and a
+// length, rather than a choice per character.
+func patternBits(pw string, pool float64) (float64, bool) {
+	runes := []rune(pw)
+	charBits := math.Log2(pool)
+
+	var bits float64
+	var found bool
+	for start := 0; start < len(runes); {
+		end, dir := start+1, 0
+		for end < len(runes) {
+			step := adjacent(runes[end-1], runes[end])
+			if step == 0 || (dir != 0 && step != dir) {
+				break
+			}
+			dir = step
+			end++
+		}
+
+		if length := end - start; length >= 3 {
+			bits += charBits + 1 + math.Log2(float64(length))
+			found = true
+		} else {
+			bits += float64(length) * charBits
+		}
+		start = end
+	}
+	return bits, found
+}
+
+// repeatBits spots a password made of a chunk repeated, like "abcabc".
+func repeatBits(pw string, pool float64) (float64, bool) {
+	runes := []rune(pw)
+	for size := 1; size <= len(runes)/2; size++ {
+		if len(runes)%size != 0 {
+			continue
+		}
+		chunk := string(runes[:size])
+		if strings.Repeat(chunk, len(runes)/size) == pw {
+			return float64(size)*math.Log2(pool) + math.Log2(float64(len(runes)/size)), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,46 @@
+package strength
+
+import "testing"
+
+// TestEstimate checks that obviously weak passwords rate as weak, and
+// random ones as strong.
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		pw       string
+		max, min Level
+	}{
+		{"1", VeryWeak, VeryWeak},
+		{"password", VeryWeak, VeryWeak},
+		{"P@ssw0rd", VeryWeak, VeryWeak},
+		{"Password123", Weak, VeryWeak},
+		{"qwertyuiop", VeryWeak, VeryWeak},
+		{"abcdefghijkl", VeryWeak, VeryWeak},
+		{"98765432", VeryWeak, VeryWeak},
+		{"aaaaaaaaaaaaaaaa", VeryWeak, VeryWeak},
+		{"xkcdxkcdxkcdxkcd", Weak, VeryWeak},
+		{"Tr0ub4dor&3", VeryStrong, Fair},
+		{"correct-horse-battery-staple", VeryStrong, Strong},
+		{"k}1c]%g}+YqJb06Lf%**", VeryStrong, VeryStrong},
+	}
+
+	for _, test := range tests {
+		res := Estimate(test.pw)
+		if res.Level > test.max || res.Level < test.min {
+			t.Errorf("%q rated %v (%.1f bits), want %v to %v", test.pw, res.Level, res.Bits, test.min, test.max)
+		}
+		if test.max <= Weak && len(test.pw) > 1 && len(res.Warnings) == 0 {
+			t.Errorf("%q had no warnings", test.pw)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"fair", "FAIR", "2"} {
+		if l, err := ParseLevel(s); err != nil || l != Fair {
+			t.Errorf("ParseLevel(%q) gave %v <%v>", s, l, err)
+		}
+	}
+	if _, err := ParseLevel("mighty"); err == nil {
+		t.Errorf("ParseLevel accepted a bad level")
+	}
+}
@@ -0,0 +1,254 @@
+// Package vault keeps named secrets in a single file, encrypted
+// with spritz.
+//
+// The entries, with their metadata and a history of changes, are
+// stored as compressed and padded JSON inside a spritz stream.  Saves
+// replace the file atomically, and fail with ErrChanged rather than
+// overwrite changes someone else saved in the meantime.
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rwtodd/Go.Spritz/spritz"
+)
+
+// ErrNoEntry is returned for names which aren't in the vault.
+var ErrNoEntry = errors.New("no such entry")
+
+// ErrChanged is returned by Save when the file was changed since the
+// vault was opened.
+var ErrChanged = errors.New("vault file changed since it was opened")
+
+// MaxHistory is the number of changes the history keeps.
+const MaxHistory = 100
+
+// formatVersion is the version of the JSON inside the vault file.
+const formatVersion = 1
+
+// Entry is one named secret.
+type Entry struct {
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Tags    []string  `json:"tags,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// HasTag tells if the entry carries the tag.
+func (e *Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Change records one change to the vault.  N.B. Old keeps the value
+// an entry had before the change, so removed secrets stay in the
+// history until they age out or ClearHistory is called.
+type Change struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"` // set, rm, or import
+	Name string    `json:"name"`
+	Old  *Entry    `json:"old,omitempty"`
+}
+
+// contents is what's stored in the file.
+type contents struct {
+	Version int               `json:"version"`
+	Entries map[string]*Entry `json:"entries"`
+	History []Change          `json:"history,omitempty"`
+}
+
+// Vault is an open vault file.  It is not safe for concurrent use.
+type Vault struct {
+	path string
+	pw   string
+	data contents
+	sum  []byte // hash of the file as we read it, or nil if it was new
+}
+
+// New gives an empty vault, which will be saved to path.
+func New(path, pw string) *Vault {
+	return &Vault{path: path, pw: pw, data: contents{Version: formatVersion, Entries: make(map[string]*Entry)}}
+}
+
+// Open decrypts and reads the vault in path.  If there isn't one, the
+// error satisfies os.IsNotExist.
+func Open(path, pw string) (*Vault, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rdr, _, err := spritz.WrapReader(bytes.NewReader(enc), pw)
+	if err != nil {
+		return nil, err
+	}
+	v := New(path, pw)
+	if err = json.NewDecoder(rdr).Decode(&v.data); err != nil {
+		return nil, fmt.Errorf("reading vault %s: %w", path, err)
+	}
+	if v.data.Version != formatVersion {
+		return nil, fmt.Errorf("vault %s has format version %d: %w", path, v.data.Version, spritz.ErrUnsupported)
+	}
+	if v.data.Entries == nil {
+		v.data.Entries = make(map[string]*Entry)
+	}
+	v.sum = spritz.Sum(256, enc)
+	return v, nil
+}
+
+// Path gives the file the vault is stored in.
+func (v *Vault) Path() string { return v.path }
+
+// Get gives a copy of the named entry.
+func (v *Vault) Get(name string) (Entry, error) {
+	e, ok := v.data.Entries[name]
+	if !ok {
+		return Entry{}, ErrNoEntry
+	}
+	return *e, nil
+}
+
+// record adds a change to the history, dropping the oldest ones
+// past MaxHistory.
+func (v *Vault) record(op, name string, old *Entry) {
+	v.data.History = append(v.data.History, Change{Time: time.Now(), Op: op, Name: name, Old: old})
+	if extra := len(v.data.History) - MaxHistory; extra > 0 {
+		v.data.History = append([]Change(nil), v.data.History[extra:]...)
+	}
+}
+
+// Set stores a value under the name, creating the entry or updating
+// it.  If tags is nil, an existing entry keeps its tags.
+func (v *Vault) Set(name, value string, tags []string) error {
+	if len(name) == 0 {
+		return errors.New("entries need a name")
+	}
+
+	now := time.Now()
+	old, exists := v.data.Entries[name]
+	e := &Entry{Name: name, Value: value, Tags: tags, Created: now, Updated: now}
+	if exists {
+		e.Created = old.Created
+		if tags == nil {
+			e.Tags = old.Tags
+		}
+	}
+	v.data.Entries[name] = e
+	v.record("set", name, old)
+	return nil
+}
+
+// Remove deletes the named entry.
+func (v *Vault) Remove(name string) error {
+	old, ok := v.data.Entries[name]
+	if !ok {
+		return ErrNoEntry
+	}
+	delete(v.data.Entries, name)
+	v.record("rm", name, old)
+	return nil
+}
+
+// Import adds the entries, replacing any with the same names, and
+// keeping their times.
+func (v *Vault) Import(entries []Entry) {
+	for idx := range entries {
+		e := entries[idx]
+		if e.Created.IsZero() {
+			e.Created = time.Now()
+		}
+		if e.Updated.IsZero() {
+			e.Updated = e.Created
+		}
+		v.record("import", e.Name, v.data.Entries[e.Name])
+		v.data.Entries[e.Name] = &e
+	}
+}
+
+// List gives copies of the entries in name order.  If tag isn't "",
+// only the entries with that tag are listed.
+func (v *Vault) List(tag string) []Entry {
+	var entries []Entry
+	for _, e := range v.data.Entries {
+		if len(tag) == 0 || e.HasTag(tag) {
+			entries = append(entries, *e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// History gives the recorded changes, oldest first.
+func (v *Vault) History() []Change {
+	return append([]Change(nil), v.data.History...)
+}
+
+// ClearHistory forgets the recorded changes, and the old values with them.
+func (v *Vault) ClearHistory() {
+	v.data.History = nil
+}
+
+// Save encrypts the vault and atomically replaces the file with it.
+// The file is written with mode 0600.
+func (v *Vault) Save() error {
+	// make sure no one else has saved since we read it
+	current, err := ioutil.ReadFile(v.path)
+	switch {
+	case err == nil && (v.sum == nil || !bytes.Equal(v.sum, spritz.Sum(256, current))):
+		return ErrChanged
+	case err != nil && !os.IsNotExist(err):
+		return err
+	case err != nil && v.sum != nil:
+		return ErrChanged
+	}
+
+	dir := filepath.Dir(v.path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(v.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+
+	var buf bytes.Buffer
+	writer, err := spritz.WrapWriterOptions(&buf, v.pw, "", spritz.Options{
+		Pad:      spritz.Padding{Policy: spritz.PadPadme},
+		Compress: spritz.CompressFlate,
+	})
+	if err == nil {
+		err = json.NewEncoder(writer).Encode(&v.data)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		_, err = tmp.Write(buf.Bytes())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), v.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	v.sum = spritz.Sum(256, buf.Bytes())
+	return nil
+}
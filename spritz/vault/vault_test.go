@@ -0,0 +1,69 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestVault stores, changes and removes entries, and checks that they
+// survive a save and reopen.
+func TestVault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("Error making temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vault.dat")
+
+	if _, err = Open(path, "pw"); !os.IsNotExist(err) {
+		t.Fatalf("Opening a missing vault gave error <%v>", err)
+	}
+
+	v := New(path, "pw")
+	v.Set("db/password", "hunter2", []string{"prod"})
+	v.Set("api/key", "12345", nil)
+	v.Set("db/password", "hunter3", nil)
+	if err = v.Remove("api/key"); err != nil {
+		t.Fatalf("Error removing: %v", err)
+	}
+	if err = v.Remove("api/key"); err != ErrNoEntry {
+		t.Fatalf("Removing twice gave error <%v>", err)
+	}
+	if err = v.Save(); err != nil {
+		t.Fatalf("Error saving: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("Vault file has the wrong mode <%v>", err)
+	}
+
+	if _, err = Open(path, "wrong"); err == nil {
+		t.Fatalf("Opened the vault with the wrong password")
+	}
+	v2, err := Open(path, "pw")
+	if err != nil {
+		t.Fatalf("Error opening: %v", err)
+	}
+	e, err := v2.Get("db/password")
+	if err != nil || e.Value != "hunter3" || !e.HasTag("prod") {
+		t.Fatalf("Got the wrong entry: %+v <%v>", e, err)
+	}
+	if len(v2.List("")) != 1 || len(v2.List("dev")) != 0 {
+		t.Fatalf("List gave %v", v2.List(""))
+	}
+	hist := v2.History()
+	if len(hist) != 4 || hist[2].Old == nil || hist[2].Old.Value != "hunter2" {
+		t.Fatalf("Wrong history: %+v", hist)
+	}
+
+	// a save from the other copy makes the first one stale
+	v2.Set("new", "value", nil)
+	if err = v2.Save(); err != nil {
+		t.Fatalf("Error saving again: %v", err)
+	}
+	v.Set("other", "value", nil)
+	if err = v.Save(); err != ErrChanged {
+		t.Fatalf("Saving a stale vault gave error <%v>", err)
+	}
+}